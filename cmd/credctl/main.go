@@ -0,0 +1,96 @@
+// Command credctl manages password credentials for POST /api/auth/login.
+// The password is read from the first line of standard input, so it never
+// shows up in the shell history or the process list.
+//
+//	echo -n 'secret' | credctl set <user_id> <login>
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	db "medods_test_task/internal/db/impl"
+	"medods_test_task/internal/model"
+	repo "medods_test_task/internal/repository/impl"
+	"medods_test_task/internal/utils"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("DB_DSN"), "database DSN")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: credctl [flags] set <user_id> <login>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dsn == "" || flag.NArg() != 3 || flag.Arg(0) != "set" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	userID, err := uuid.Parse(flag.Arg(1))
+	if err != nil {
+		log.Fatalf("invalid user_id: %v", err)
+	}
+	login := utils.NormalizeLogin(flag.Arg(2))
+	if login == "" {
+		log.Fatal("login must not be empty")
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatalf("failed to read password from stdin: %v", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if len([]rune(password)) < intOrDefault("PASSWORD_MIN_LENGTH", 8) {
+		log.Fatal("password is too short")
+	}
+
+	passwordHash, err := utils.NewPasswordHasher(argon2Params()).Hash(password)
+	if err != nil {
+		log.Fatalf("failed to hash password: %v", err)
+	}
+
+	database := db.NewPostgresDB()
+	if err := database.Connect(*dsn); err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer func() {
+		_ = database.Close()
+	}()
+	if err := database.Migrate(&model.Credential{}); err != nil {
+		log.Fatalf("failed to migrate: %v", err)
+	}
+
+	credential := &model.Credential{UserID: userID, Login: login, PasswordHash: passwordHash}
+	if err := repo.NewCredentialRepository(database.DB()).Save(credential); err != nil {
+		log.Fatalf("failed to save credential: %v", err)
+	}
+	fmt.Printf("password set, user: %s, login: %s\n", userID, login)
+}
+
+// argon2Params reads the same PASSWORD_ARGON2_* variables as the server, so
+// hashes made here are not rehashed on the first login.
+func argon2Params() utils.Argon2Params {
+	defaults := utils.DefaultArgon2Params
+	return utils.Argon2Params{
+		Memory:      uint32(intOrDefault("PASSWORD_ARGON2_MEMORY", int(defaults.Memory))),
+		Iterations:  uint32(intOrDefault("PASSWORD_ARGON2_ITERATIONS", int(defaults.Iterations))),
+		Parallelism: uint8(intOrDefault("PASSWORD_ARGON2_PARALLELISM", int(defaults.Parallelism))),
+	}
+}
+
+func intOrDefault(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+// Command keyctl manages the signing keyring used when JWT_KEYRING_DIR is
+// set. Running servers pick up changes on their next reload tick or on
+// SIGHUP, so rotation never needs a restart. A rotated key is staged: it is
+// published at once and becomes active after the activation delay.
+//
+//	keyctl list
+//	keyctl rotate
+//	keyctl retire <kid>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"medods_test_task/internal/signing"
+)
+
+func main() {
+	dir := flag.String("dir", os.Getenv("JWT_KEYRING_DIR"), "keyring directory")
+	alg := flag.String("alg", envOrDefault("JWT_ALGORITHM", signing.AlgorithmHS512), "algorithm for new keys")
+	window := flag.Duration("verify-window", envDuration("ACCESS_TOKEN_TTL", 15*time.Minute), "how long rotated keys keep verifying tokens")
+	delay := flag.Duration("activation-delay", envDuration("JWT_KEYRING_RELOAD_INTERVAL", time.Minute)+signing.JWKSMaxAge,
+		"how long a rotated key is only published before it becomes active")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: keyctl [flags] list|rotate|retire <kid>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dir == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	keyring, err := signing.OpenKeyring(*dir, *alg, *window, *delay)
+	if err != nil {
+		log.Fatalf("failed to open keyring: %v", err)
+	}
+
+	switch flag.Arg(0) {
+	case "list":
+		err = list(keyring)
+	case "rotate":
+		var entry signing.ManifestEntry
+		if entry, err = keyring.Rotate(); err == nil {
+			fmt.Printf("staged kid: %s, active from %s\n", entry.KID, entry.ActivateAt.Format(time.RFC3339))
+		}
+	case "retire":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if err = keyring.Retire(flag.Arg(1)); err == nil {
+			fmt.Printf("retired kid: %s\n", flag.Arg(1))
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func list(keyring *signing.Keyring) error {
+	entries, err := keyring.Entries()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KID\tALG\tSTATE\tCREATED\tROTATED\tACTIVATES")
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.KID, entry.Algorithm, entry.State, entry.CreatedAt.Format(time.RFC3339),
+			formatTime(entry.RotatedAt), formatTime(entry.ActivateAt))
+	}
+	return w.Flush()
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -10,24 +10,42 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
+	"gorm.io/gorm"
 
 	_ "medods_test_task/docs"
 	"medods_test_task/internal/config"
 	db "medods_test_task/internal/db/impl"
+	"medods_test_task/internal/dpop"
 	"medods_test_task/internal/handler"
 	"medods_test_task/internal/model"
+	provider "medods_test_task/internal/provider/impl"
+	providerIntf "medods_test_task/internal/provider/intf"
 	repo "medods_test_task/internal/repository/impl"
 	service "medods_test_task/internal/service/impl"
+	"medods_test_task/internal/signing"
+	tokenFormat "medods_test_task/internal/tokenformat/impl"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
 )
 
 func main() {
 	gin.SetMode(gin.ReleaseMode)
-	cfg := config.Load()
+	cfg, err := config.LoadOrError()
+	if err != nil {
+		log.Fatal(err)
+	}
 	database := db.NewPostgresDB()
 	if err := database.Connect(cfg.DbDsn); err != nil {
 		log.Fatalf("failed to connect to DB: %v", err)
@@ -38,20 +56,197 @@ func main() {
 		}
 	}()
 
-	if err := database.Migrate(&model.RefreshToken{}); err != nil {
+	if err := database.Migrate(&model.RefreshToken{}, &model.AccessToken{}, &model.User{}, &model.UserRole{}, &model.Credential{}); err != nil {
 		log.Fatalf("failed to migrate: %v", err)
 	}
 
+	keyring, err := loadKeyring(cfg)
+	if err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+	go keyring.RunAutoRotation(context.Background(), cfg.JWTKeyRotation, cfg.JWTKeyringReload)
+	go reloadKeyringOnSignal(keyring)
+
+	accessTokenFormat, err := loadTokenFormat(cfg, keyring, database.DB())
+	if err != nil {
+		log.Fatalf("failed to load access token format: %v", err)
+	}
+
+	userDirectory, err := loadUserDirectory(cfg, database.DB())
+	if err != nil {
+		log.Fatalf("failed to load user directory: %v", err)
+	}
+
+	roleProvider, err := loadRoleProvider(cfg, database.DB())
+	if err != nil {
+		log.Fatalf("failed to load role provider: %v", err)
+	}
+
+	claimsEnricher, err := loadClaimsEnricher(cfg)
+	if err != nil {
+		log.Fatalf("failed to load claims enricher: %v", err)
+	}
+
 	refreshTokenRepository := repo.NewRefreshTokenRepository(database.DB())
-	authService := service.NewAuthService(refreshTokenRepository)
-	authHandler := handler.NewAuthHandler(authService)
+	authService := service.NewAuthService(refreshTokenRepository, keyring, accessTokenFormat, roleProvider, claimsEnricher, userDirectory)
+	dpopVerifier := dpop.NewVerifier(cfg.DPoPProofMaxAge, cfg.JWTLeeway, cfg.DPoPNonceLifetime, cfg.DPoPPublicURLs)
+	passwordService, err := service.NewPasswordService(repo.NewCredentialRepository(database.DB()), authService)
+	if err != nil {
+		log.Fatalf("failed to create password service: %v", err)
+	}
+	authHandler := handler.NewAuthHandler(authService, passwordService, accessTokenFormat, dpopVerifier)
+	sessionHandler := handler.NewSessionHandler(authService, accessTokenFormat, dpopVerifier)
+	oauthHandler := handler.NewOAuthHandler(authService, passwordService, accessTokenFormat, dpopVerifier)
+	jwksHandler := handler.NewJWKSHandler(keyring)
+	oidcHandler := handler.NewOIDCHandler(keyring)
 
 	router := gin.Default()
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	jwksHandler.RegisterJWKSHandlers(router)
+	oidcHandler.RegisterOIDCHandlers(router)
 	api := router.Group("/api")
 
 	authHandler.RegisterAuthHandlers(api)
+	sessionHandler.RegisterSessionHandlers(api)
+	oauthHandler.RegisterOAuthHandlers(api)
+
+	if cfg.TLSCertFile != "" {
+		tlsConfig, err := loadTLSConfig(cfg)
+		if err != nil {
+			log.Fatalf("failed to load TLS config: %v", err)
+		}
+		server := &http.Server{Addr: cfg.TLSAddr, Handler: router, TLSConfig: tlsConfig}
+		go func() {
+			if err := server.ListenAndServeTLS("", ""); err != nil {
+				log.Fatalf("failed to start TLS server: %v", err)
+			}
+		}()
+	}
+
 	if err := router.Run(":8080"); err != nil {
 		log.Fatalf("failed to start server: %v", err)
 	}
 }
+
+func loadKeyring(cfg *config.Config) (*signing.Keyring, error) {
+	if cfg.JWTKeyringDir != "" {
+		return signing.OpenKeyring(cfg.JWTKeyringDir, cfg.JWTAlgorithm, cfg.AccessTokenTTL, cfg.JWTKeyringReload+signing.JWKSMaxAge)
+	}
+
+	var (
+		key *signing.Key
+		err error
+	)
+	if cfg.JWTAlgorithm == signing.AlgorithmHS512 {
+		key, err = signing.NewSymmetricKey(cfg.JWTSecret, cfg.JWTKeyID)
+	} else {
+		key, err = signing.LoadKey(cfg.JWTAlgorithm, cfg.JWTPrivateKeyFile, cfg.JWTKeyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return signing.NewStaticKeyring(key), nil
+}
+
+// loadTokenFormat builds the configured access token format. v4.public
+// signs with the keyring, so JWT_ALGORITHM must be EdDSA.
+func loadTokenFormat(cfg *config.Config, keyring *signing.Keyring, database *gorm.DB) (tokenFormatIntf.TokenFormat, error) {
+	switch cfg.TokenFormat {
+	case config.TokenFormatPASETOPublic:
+		return tokenFormat.NewPASETOPublicTokenFormat(keyring)
+	case config.TokenFormatPASETOLocal:
+		return tokenFormat.NewPASETOLocalTokenFormat(cfg.PASETOLocalKey)
+	case config.TokenFormatReference:
+		return tokenFormat.NewReferenceTokenFormat(repo.NewAccessTokenRepository(database), cfg.ReferenceRetention), nil
+	default:
+		return tokenFormat.NewJWTTokenFormat(keyring), nil
+	}
+}
+
+// loadTLSConfig asks clients for a certificate without requiring one, so
+// tokens can be bound to it. With TLS_CLIENT_CA_FILE the certificate must
+// chain to that CA, otherwise any certificate, self-signed included, is
+// accepted and only its thumbprint matters.
+func loadTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   tls.RequestClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.TLSClientCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+func loadUserDirectory(cfg *config.Config, database *gorm.DB) (providerIntf.UserDirectory, error) {
+	switch cfg.UserDirectory {
+	case config.UserDirectoryStatic:
+		return provider.NewStaticUserDirectory(cfg.UsersFile)
+	case config.UserDirectorySQL:
+		return provider.NewCachedUserDirectory(provider.NewSQLUserDirectory(repo.NewUserRepository(database)), cfg.UsersCacheTTL), nil
+	case config.UserDirectoryHTTP:
+		return provider.NewCachedUserDirectory(provider.NewHTTPUserDirectory(cfg.UsersURL, cfg.UsersTimeout), cfg.UsersCacheTTL), nil
+	default:
+		return provider.NewEmptyUserDirectory(), nil
+	}
+}
+
+func loadRoleProvider(cfg *config.Config, database *gorm.DB) (providerIntf.RoleProvider, error) {
+	switch cfg.RoleProvider {
+	case config.RoleProviderStatic:
+		return provider.NewStaticRoleProvider(cfg.RolesFile)
+	case config.RoleProviderSQL:
+		return provider.NewSQLRoleProvider(repo.NewUserRoleRepository(database)), nil
+	case config.RoleProviderHTTP:
+		return provider.NewHTTPRoleProvider(cfg.RolesURL, cfg.RolesTimeout), nil
+	default:
+		return provider.NewEmptyRoleProvider(), nil
+	}
+}
+
+// loadClaimsEnricher builds the configured enricher. With the http enricher
+// CLAIMS_FILE, when set, provides the fallback claims.
+func loadClaimsEnricher(cfg *config.Config) (providerIntf.ClaimsEnricher, error) {
+	switch cfg.ClaimsEnricher {
+	case config.ClaimsEnricherStatic:
+		return provider.NewStaticClaimsEnricher(cfg.ClaimsFile)
+	case config.ClaimsEnricherHTTP:
+		fallback := provider.NewEmptyClaimsEnricher()
+		if cfg.ClaimsFile != "" {
+			var err error
+			if fallback, err = provider.NewStaticClaimsEnricher(cfg.ClaimsFile); err != nil {
+				return nil, err
+			}
+		}
+		return provider.NewHTTPClaimsEnricher(cfg.ClaimsURL, cfg.ClaimsTimeout, fallback), nil
+	default:
+		return provider.NewEmptyClaimsEnricher(), nil
+	}
+}
+
+func reloadKeyringOnSignal(keyring *signing.Keyring) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := keyring.Reload(); err != nil {
+			log.Printf("failed to reload keyring: %v", err)
+			continue
+		}
+		log.Printf("Keyring reloaded. Active kid: %s", keyring.Active().ID)
+	}
+}
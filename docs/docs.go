@@ -15,9 +15,84 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/auth/change-password": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Меняет пароль после проверки текущего и завершает все остальные сессии пользователя. Недоступна в сессии имперсонации. Новый пароль должен быть не короче PASSWORD_MIN_LENGTH символов. При TOKEN_TRANSPORT=cookie запрос с cookie требует заголовка X-CSRF-Token",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Смена пароля",
+                "parameters": [
+                    {
+                        "description": "Текущий и новый пароль",
+                        "name": "changePasswordRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.ChangePasswordRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.MessageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/auth/create-tokens": {
             "get": {
-                "description": "Генерирует новые токены по userID",
+                "description": "Генерирует новые токены по userID. Вместе с ними выдаётся id_token OpenID Connect, если JWT_ALGORITHM асимметричный. С заголовком DPoP или клиентским TLS-сертификатом токены привязываются к ключу или сертификату. При TOKEN_TRANSPORT=cookie access и refresh токены передаются в HttpOnly cookie вместе с cookie csrf_token, а не в теле ответа. Пользователь проверяется в USER_DIRECTORY: для неизвестного возвращается 404, для отключённого 403, и все его сессии завершаются. При CREATE_TOKENS=client требует аутентификации конфиденциального клиента из OAUTH_CLIENTS через Basic, при CREATE_TOKENS=disabled маршрут отключён. Выдаются только scope, разрешённые клиенту в OAUTH_CLIENT_SCOPES, а без аутентификации клиента - только PUBLIC_CLIENT_SCOPES",
                 "consumes": [
                     "application/json"
                 ],
@@ -36,6 +111,30 @@ const docTemplate = `{
                         "name": "user_id",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "OIDC client_id, попадает в aud id_token",
+                        "name": "client_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "OIDC nonce, попадает в id_token",
+                        "name": "nonce",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Запрашиваемые scope через пробел",
+                        "name": "scope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof (RFC 9449)",
+                        "name": "DPoP",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -51,6 +150,30 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -70,7 +193,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Деактивирует все refresh токены по userID",
+                "description": "Деактивирует все refresh токены по userID. При TOKEN_TRANSPORT=cookie удаляет cookie с токенами, а запрос с cookie требует заголовка X-CSRF-Token",
                 "consumes": [
                     "application/json"
                 ],
@@ -81,6 +204,14 @@ const docTemplate = `{
                     "auth"
                 ],
                 "summary": "Деавторизация пользователя",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -88,11 +219,105 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.MessageResponse"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/login": {
+            "post": {
+                "description": "Проверяет пароль и выдаёт токены так же, как create-tokens: с id_token, привязкой к DPoP или сертификату и проверкой USER_DIRECTORY. Пароли хранятся в виде хешей Argon2id; хеш с устаревшими параметрами пересчитывается при входе. Неизвестный логин и неверный пароль неразличимы ни по ответу, ни по времени. При TOKEN_TRANSPORT=cookie принимает только Content-Type: application/json",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Вход по логину и паролю",
+                "parameters": [
+                    {
+                        "description": "Логин и пароль",
+                        "name": "loginRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.LoginRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof (RFC 9449)",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.TokensResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorResponse"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -134,53 +359,81 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/update-tokens": {
-            "post": {
+        "/auth/sessions": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает активные сессии пользователя. ID сессии не меняется при обновлении токенов, last_used_at - время последнего обновления",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sessions"
+                ],
+                "summary": "Список активных сессий",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.SessionsResponse"
+                        }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/sessions/revoke-others": {
+            "post": {
+                "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Обновляет токены по access и refresh токенам",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Деактивирует все сессии пользователя, кроме текущей",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "sessions"
                 ],
-                "summary": "Обновление access и refresh токенов",
+                "summary": "Завершение остальных сессий",
                 "parameters": [
                     {
-                        "description": "Refresh Token Input",
-                        "name": "updateTokensRequest",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/dto.UpdateTokensRequest"
-                        }
+                        "type": "string",
+                        "description": "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/dto.TokensResponse"
+                            "$ref": "#/definitions/dto.MessageResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorResponse"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/dto.ErrorResponse"
                         }
@@ -193,44 +446,726 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "dto.ErrorResponse": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string"
-                }
-            }
-        },
-        "dto.MessageResponse": {
-            "type": "object",
-            "properties": {
-                "message": {
-                    "type": "string"
-                }
-            }
         },
-        "dto.TokensResponse": {
-            "type": "object",
-            "properties": {
-                "access_token": {
-                    "type": "string"
-                },
-                "refresh_token": {
-                    "type": "string"
-                }
-            }
-        },
-        "dto.UpdateTokensRequest": {
-            "type": "object",
-            "required": [
-                "refresh_token"
-            ],
-            "properties": {
+        "/auth/sessions/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Деактивирует одну сессию пользователя по её ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sessions"
+                ],
+                "summary": "Завершение сессии",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session ID (UUID)",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.MessageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/update-tokens": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Обновляет токены по refresh токену вида \u003cid\u003e.\u003csecret\u003e. Access токен необязателен и может быть просрочен; для refresh токенов старого формата без id он обязателен. Поле scope может только сузить scope нового access токена. Привязанный refresh токен обновляется только с DPoP proof того же ключа или тем же клиентским сертификатом. При TOKEN_TRANSPORT=cookie refresh токен берётся из cookie, если не передан в теле, а запрос с cookie требует заголовка X-CSRF-Token",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Обновление access и refresh токенов",
+                "parameters": [
+                    {
+                        "description": "Refresh Token Input",
+                        "name": "updateTokensRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.UpdateTokensRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof (RFC 9449)",
+                        "name": "DPoP",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.TokensResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/introspect": {
+            "post": {
+                "description": "Возвращает состояние access или refresh токена по RFC 7662. Требует аутентификации клиента (Basic или client_id/client_secret)",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Интроспекция токена",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access или refresh токен",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "access_token",
+                            "refresh_token"
+                        ],
+                        "type": "string",
+                        "description": "Подсказка о типе токена",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthIntrospectionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/revoke": {
+            "post": {
+                "description": "Завершает сессию, к которой относится access или refresh токен, по RFC 7009. Остальные сессии пользователя не затрагиваются. Конфиденциальный клиент из OAUTH_CLIENTS аутентифицируется (Basic или client_id/client_secret), и отозвать можно только токен, выданный этому клиенту, или токен без клиента. Access токен, полученный обменом токенов (RFC 8693), выдан клиенту из его act.client_id, и отозвать его может только этот клиент. Неизвестный или недействительный токен не считается ошибкой: ответ 200",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Отзыв токена",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access или refresh токен",
+                        "name": "token",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "access_token",
+                            "refresh_token"
+                        ],
+                        "type": "string",
+                        "description": "Подсказка о типе токена",
+                        "name": "token_type_hint",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "client_id",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client secret конфиденциального клиента",
+                        "name": "client_secret",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oauth/token": {
+            "post": {
+                "description": "Выдаёт токены по RFC 6749. Поддерживаются grant_type=refresh_token, password и обмен токенов по RFC 8693 (urn:ietf:params:oauth:grant-type:token-exchange, требует аутентификации клиента). Конфиденциальный клиент из OAUTH_CLIENTS аутентифицируется через Basic или client_id/client_secret, и его refresh токены принимаются только от него. При grant_type=password выдаются только scope из OAUTH_CLIENT_SCOPES аутентифицированного клиента или PUBLIC_CLIENT_SCOPES для публичного. С заголовком DPoP или клиентским TLS-сертификатом токены привязываются к ключу или сертификату, token_type привязанных к DPoP токенов - DPoP. Привязанные subject_token и actor_token при обмене требуют proof того же ключа (с ath обмениваемого токена) или того же сертификата",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Токен-эндпоинт OAuth 2.0",
+                "parameters": [
+                    {
+                        "enum": [
+                            "refresh_token",
+                            "password",
+                            "urn:ietf:params:oauth:grant-type:token-exchange"
+                        ],
+                        "type": "string",
+                        "description": "Grant type",
+                        "name": "grant_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Refresh token (для grant_type=refresh_token)",
+                        "name": "refresh_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Логин (для grant_type=password)",
+                        "name": "username",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Пароль (для grant_type=password)",
+                        "name": "password",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "client_id",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client secret конфиденциального клиента",
+                        "name": "client_secret",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Scope",
+                        "name": "scope",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access token, который обменивается, или ID пользователя для имперсонации (для token-exchange)",
+                        "name": "subject_token",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "urn:ietf:params:oauth:token-type:access_token",
+                            "urn:medods:params:oauth:token-type:user_id"
+                        ],
+                        "type": "string",
+                        "description": "Тип subject_token",
+                        "name": "subject_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access token сотрудника, выполняющего имперсонацию",
+                        "name": "actor_token",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "urn:ietf:params:oauth:token-type:access_token"
+                        ],
+                        "type": "string",
+                        "description": "Тип actor_token",
+                        "name": "actor_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "urn:ietf:params:oauth:token-type:access_token"
+                        ],
+                        "type": "string",
+                        "description": "Тип запрашиваемого токена",
+                        "name": "requested_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Устаревшее расширение: ID пользователя для имперсонации, subject_token - токен сотрудника",
+                        "name": "requested_subject",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Audience запрашиваемого токена",
+                        "name": "audience",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof (RFC 9449)",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthTokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OAuthErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/userinfo": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает claims пользователя по access токену со scope openid. Аналог /auth/me в формате OpenID Connect",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oidc"
+                ],
+                "summary": "UserInfo OpenID Connect",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.UserInfoResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "dto.Actor": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "$ref": "#/definitions/dto.Actor"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "sub": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ChangePasswordRequest": {
+            "type": "object",
+            "required": [
+                "current_password",
+                "new_password"
+            ],
+            "properties": {
+                "current_password": {
+                    "type": "string"
+                },
+                "new_password": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.Confirmation": {
+            "type": "object",
+            "properties": {
+                "jkt": {
+                    "type": "string"
+                },
+                "x5t#S256": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.LoginRequest": {
+            "type": "object",
+            "required": [
+                "login",
+                "password"
+            ],
+            "properties": {
+                "client_id": {
+                    "type": "string"
+                },
+                "login": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "nonce": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.MessageResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.OAuthErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "error_description": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.OAuthIntrospectionResponse": {
+            "type": "object",
+            "properties": {
+                "act": {
+                    "$ref": "#/definitions/dto.Actor"
+                },
+                "active": {
+                    "type": "boolean"
+                },
+                "auth_time": {
+                    "type": "integer"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "cnf": {
+                    "$ref": "#/definitions/dto.Confirmation"
+                },
+                "exp": {
+                    "type": "integer"
+                },
+                "iat": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "jti": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "sub": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.OAuthTokenResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "id_token": {
+                    "type": "string"
+                },
+                "issued_token_type": {
+                    "type": "string"
+                },
                 "refresh_token": {
                     "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.SessionResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "current": {
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "impersonated_by": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.SessionsResponse": {
+            "type": "object",
+            "properties": {
+                "sessions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.SessionResponse"
+                    }
+                }
+            }
+        },
+        "dto.TokensResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "id_token": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.UpdateTokensRequest": {
+            "type": "object",
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
                 }
             }
         },
@@ -241,6 +1176,14 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "dto.UserInfoResponse": {
+            "type": "object",
+            "properties": {
+                "sub": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -1,18 +1,126 @@
 package config
 
 import (
+	"encoding/hex"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	SessionLimitPolicyEvictOldest = "evict_oldest"
+	SessionLimitPolicyReject      = "reject"
+)
+
+const (
+	ClaimsEnricherNone   = "none"
+	ClaimsEnricherStatic = "static"
+	ClaimsEnricherHTTP   = "http"
+)
+
+const (
+	TokenFormatJWT          = "jwt"
+	TokenFormatPASETOPublic = "v4.public"
+	TokenFormatPASETOLocal  = "v4.local"
+	TokenFormatReference    = "reference"
+)
+
+const (
+	TokenTransportBody   = "body"
+	TokenTransportCookie = "cookie"
+)
+
+const (
+	CookieSameSiteStrict = "strict"
+	CookieSameSiteLax    = "lax"
+	CookieSameSiteNone   = "none"
+)
+
+// Who may call GET /auth/create-tokens, which signs a user in by ID alone.
+const (
+	CreateTokensOpen     = "open"
+	CreateTokensClient   = "client"
+	CreateTokensDisabled = "disabled"
+)
+
+const (
+	UserDirectoryNone   = "none"
+	UserDirectoryStatic = "static"
+	UserDirectorySQL    = "sql"
+	UserDirectoryHTTP   = "http"
+)
+
+const (
+	RoleProviderNone   = "none"
+	RoleProviderStatic = "static"
+	RoleProviderSQL    = "sql"
+	RoleProviderHTTP   = "http"
+)
+
 type Config struct {
-	DbDsn          string
-	AccessTokenTTL time.Duration
-	JWTSecret      []byte
-	WebHook        string
+	DbDsn              string
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+	SessionLifetime    time.Duration
+	SessionIdle        time.Duration
+	RefreshGracePeriod time.Duration
+	RefreshTokenPepper []byte
+	MaxSessionsPerUser int
+	SessionLimitPolicy string
+	JWTAlgorithm       string
+	JWTSecret          []byte
+	JWTPrivateKeyFile  string
+	JWTKeyID           string
+	JWTKeyringDir      string
+	JWTKeyRotation     time.Duration
+	JWTKeyringReload   time.Duration
+	TokenFormat        string
+	PASETOLocalKey     []byte
+	ReferenceRetention time.Duration
+	TokenTransport     string
+	CookieDomain       string
+	CookieSameSite     string
+	OAuthClients       map[string]string
+	ClientScopes       map[string][]string
+	PublicClientScopes []string
+	Issuer             string
+	OIDCClientID       string
+	JWTAudience        string
+	JWTLeeway          time.Duration
+	SupportedScopes    []string
+	UserDirectory      string
+	UsersFile          string
+	UsersURL           string
+	UsersTimeout       time.Duration
+	UsersCacheTTL      time.Duration
+	Argon2Memory       uint32
+	Argon2Iterations   uint32
+	Argon2Parallelism  uint8
+	PasswordMinLength  int
+	PasswordHashSlots  int
+	CreateTokens       string
+	RoleProvider       string
+	RolesFile          string
+	RolesURL           string
+	RolesTimeout       time.Duration
+	ClaimsEnricher     string
+	ClaimsFile         string
+	ClaimsURL          string
+	ClaimsTimeout      time.Duration
+	ImpersonationRole  string
+	ImpersonationTTL   time.Duration
+	DPoPProofMaxAge    time.Duration
+	DPoPNonceLifetime  time.Duration
+	DPoPPublicURLs     []string
+	TLSAddr            string
+	TLSCertFile        string
+	TLSKeyFile         string
+	TLSClientCAFile    string
+	WebHook            string
 }
 
 var (
@@ -20,6 +128,17 @@ var (
 	once sync.Once
 )
 
+// LoadOrError is Load for callers that report a bad configuration rather
+// than crash with a stack trace.
+func LoadOrError() (cfg *Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return Load(), nil
+}
+
 func Load() *Config {
 	once.Do(func() {
 		ttlStr := getEnv("ACCESS_TOKEN_TTL")
@@ -28,13 +147,140 @@ func Load() *Config {
 			panic(fmt.Sprintf("Failed to load config: ACCESS_TOKEN_TTL is incorrect: %s", ttlStr))
 		}
 
-		jwtSecret := getEnv("JWT_SECRET")
+		userDirectory := getOneOfOrDefault("USER_DIRECTORY", UserDirectoryNone, UserDirectoryStatic, UserDirectorySQL, UserDirectoryHTTP)
+		var usersFile, usersURL string
+		switch userDirectory {
+		case UserDirectoryStatic:
+			usersFile = getEnv("USERS_FILE")
+		case UserDirectoryHTTP:
+			usersURL = getEnv("USERS_URL")
+		}
+
+		roleProvider := getOneOfOrDefault("ROLE_PROVIDER", RoleProviderNone, RoleProviderStatic, RoleProviderSQL, RoleProviderHTTP)
+		var rolesFile, rolesURL string
+		switch roleProvider {
+		case RoleProviderStatic:
+			rolesFile = getEnv("ROLES_FILE")
+		case RoleProviderHTTP:
+			rolesURL = getEnv("ROLES_URL")
+		}
+
+		claimsEnricher := getOneOfOrDefault("CLAIMS_ENRICHER", ClaimsEnricherNone, ClaimsEnricherStatic, ClaimsEnricherHTTP)
+		var claimsFile, claimsURL string
+		switch claimsEnricher {
+		case ClaimsEnricherStatic:
+			claimsFile = getEnv("CLAIMS_FILE")
+		case ClaimsEnricherHTTP:
+			claimsURL = getEnv("CLAIMS_URL")
+			// Optional here: the fallback claims when the service fails.
+			claimsFile = os.Getenv("CLAIMS_FILE")
+		}
+
+		jwtAlgorithm := getEnvOrDefault("JWT_ALGORITHM", "HS512")
+		jwtKeyringDir := os.Getenv("JWT_KEYRING_DIR")
+
+		var jwtSecret, jwtPrivateKeyFile string
+		switch {
+		case jwtKeyringDir != "":
+		case jwtAlgorithm == "HS512":
+			jwtSecret = getEnv("JWT_SECRET")
+		default:
+			jwtPrivateKeyFile = getEnv("JWT_PRIVATE_KEY_FILE")
+		}
+
+		tokenFormat := getOneOfOrDefault("ACCESS_TOKEN_FORMAT", TokenFormatJWT, TokenFormatPASETOPublic, TokenFormatPASETOLocal, TokenFormatReference)
+		var pasetoLocalKey []byte
+		if tokenFormat == TokenFormatPASETOLocal {
+			keyStr := getEnv("PASETO_LOCAL_KEY")
+			if pasetoLocalKey, err = hex.DecodeString(keyStr); err != nil || len(pasetoLocalKey) != 32 {
+				panic("Failed to load config: PASETO_LOCAL_KEY must be 32 bytes in hex")
+			}
+		}
+
+		oauthClients := getClientsOrEmpty("OAUTH_CLIENTS")
+		clientScopes := getClientScopesOrEmpty("OAUTH_CLIENT_SCOPES", oauthClients)
+
+		issuer := strings.TrimSuffix(getEnvOrDefault("ISSUER", "http://localhost:8080"), "/")
+		dpopPublicURLs := getListOrEmpty("DPOP_PUBLIC_URLS")
+		if len(dpopPublicURLs) == 0 {
+			dpopPublicURLs = []string{issuer}
+		}
+		for i, publicURL := range dpopPublicURLs {
+			dpopPublicURLs[i] = strings.TrimSuffix(publicURL, "/")
+		}
+
+		// Argon2 needs at least 8 KiB of memory per lane and silently
+		// raises smaller values, which would change stored hashes.
+		argon2Parallelism := getIntInRangeOrDefault("PASSWORD_ARGON2_PARALLELISM", 4, 1, math.MaxUint8)
+		argon2Memory := getIntInRangeOrDefault("PASSWORD_ARGON2_MEMORY", 64*1024, 8*argon2Parallelism, math.MaxUint32)
+		argon2Iterations := getIntInRangeOrDefault("PASSWORD_ARGON2_ITERATIONS", 3, 1, math.MaxUint32)
+
+		tlsCertFile := os.Getenv("TLS_CERT_FILE")
+		var tlsKeyFile string
+		if tlsCertFile != "" {
+			tlsKeyFile = getEnv("TLS_KEY_FILE")
+		}
 
 		cfg = &Config{
-			DbDsn:          getEnv("DB_DSN"),
-			AccessTokenTTL: ttl,
-			JWTSecret:      []byte(jwtSecret),
-			WebHook:        getEnv("WEBHOOK"),
+			DbDsn:              getEnv("DB_DSN"),
+			AccessTokenTTL:     ttl,
+			RefreshTokenTTL:    getDurationOrDefault("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			SessionLifetime:    getDurationOrDefault("SESSION_MAX_LIFETIME", 90*24*time.Hour),
+			SessionIdle:        getDurationOrDefault("SESSION_IDLE_TIMEOUT", 0),
+			RefreshGracePeriod: getDurationOrDefault("REFRESH_GRACE_PERIOD", 0),
+			RefreshTokenPepper: getPepper("REFRESH_TOKEN_PEPPER"),
+			MaxSessionsPerUser: getIntOrDefault("MAX_SESSIONS_PER_USER", 0),
+			SessionLimitPolicy: getOneOfOrDefault("SESSION_LIMIT_POLICY", SessionLimitPolicyEvictOldest, SessionLimitPolicyReject),
+			JWTAlgorithm:       jwtAlgorithm,
+			JWTSecret:          []byte(jwtSecret),
+			JWTPrivateKeyFile:  jwtPrivateKeyFile,
+			JWTKeyID:           os.Getenv("JWT_KEY_ID"),
+			JWTKeyringDir:      jwtKeyringDir,
+			JWTKeyRotation:     getDurationOrDefault("JWT_KEY_ROTATION_INTERVAL", 0),
+			JWTKeyringReload:   getDurationOrDefault("JWT_KEYRING_RELOAD_INTERVAL", time.Minute),
+			TokenFormat:        tokenFormat,
+			PASETOLocalKey:     pasetoLocalKey,
+			ReferenceRetention: getDurationOrDefault("REFERENCE_TOKEN_RETENTION", 24*time.Hour),
+			TokenTransport:     getOneOfOrDefault("TOKEN_TRANSPORT", TokenTransportBody, TokenTransportCookie),
+			CookieDomain:       os.Getenv("COOKIE_DOMAIN"),
+			CookieSameSite:     getOneOfOrDefault("COOKIE_SAME_SITE", CookieSameSiteStrict, CookieSameSiteLax, CookieSameSiteNone),
+			OAuthClients:       oauthClients,
+			ClientScopes:       clientScopes,
+			PublicClientScopes: getListOrEmpty("PUBLIC_CLIENT_SCOPES"),
+			Issuer:             issuer,
+			OIDCClientID:       getEnvOrDefault("OIDC_CLIENT_ID", "medods"),
+			JWTAudience:        getEnvOrDefault("JWT_AUDIENCE", "medods-api"),
+			JWTLeeway:          getDurationOrDefault("JWT_LEEWAY", 0),
+			SupportedScopes:    getListOrEmpty("SUPPORTED_SCOPES"),
+			UserDirectory:      userDirectory,
+			UsersFile:          usersFile,
+			UsersURL:           usersURL,
+			UsersTimeout:       getDurationOrDefault("USERS_TIMEOUT", 2*time.Second),
+			UsersCacheTTL:      getDurationOrDefault("USERS_CACHE_TTL", 10*time.Second),
+			Argon2Memory:       uint32(argon2Memory),
+			Argon2Iterations:   uint32(argon2Iterations),
+			Argon2Parallelism:  uint8(argon2Parallelism),
+			PasswordMinLength:  getIntOrDefault("PASSWORD_MIN_LENGTH", 8),
+			PasswordHashSlots:  getIntOrDefault("PASSWORD_HASH_CONCURRENCY", 4),
+			CreateTokens:       getOneOfOrDefault("CREATE_TOKENS", CreateTokensOpen, CreateTokensClient, CreateTokensDisabled),
+			RoleProvider:       roleProvider,
+			RolesFile:          rolesFile,
+			RolesURL:           rolesURL,
+			RolesTimeout:       getDurationOrDefault("ROLES_TIMEOUT", 2*time.Second),
+			ClaimsEnricher:     claimsEnricher,
+			ClaimsFile:         claimsFile,
+			ClaimsURL:          claimsURL,
+			ClaimsTimeout:      getDurationOrDefault("CLAIMS_TIMEOUT", 500*time.Millisecond),
+			ImpersonationRole:  getEnvOrDefault("IMPERSONATION_ROLE", "support"),
+			ImpersonationTTL:   getDurationOrDefault("IMPERSONATION_MAX_LIFETIME", time.Hour),
+			DPoPProofMaxAge:    getDurationOrDefault("DPOP_PROOF_MAX_AGE", time.Minute),
+			DPoPNonceLifetime:  getDurationOrDefault("DPOP_NONCE_LIFETIME", 5*time.Minute),
+			DPoPPublicURLs:     dpopPublicURLs,
+			TLSAddr:            getEnvOrDefault("TLS_ADDR", ":8443"),
+			TLSCertFile:        tlsCertFile,
+			TLSKeyFile:         tlsKeyFile,
+			TLSClientCAFile:    os.Getenv("TLS_CLIENT_CA_FILE"),
+			WebHook:            getEnv("WEBHOOK"),
 		}
 	})
 	return cfg
@@ -47,3 +293,120 @@ func getEnv(key string) string {
 	}
 	return value
 }
+
+// getPepper reads the server secret that keys the HMAC of refresh tokens and
+// reference access tokens. There is no safe default: every instance must use
+// the same value, and changing it invalidates every issued token.
+func getPepper(key string) []byte {
+	value := os.Getenv(key)
+	if strings.TrimSpace(value) == "" {
+		panic(fmt.Sprintf("Failed to load config: %s is not set. It keys the HMAC-SHA256 hashes of refresh tokens; "+
+			"set it to a long random secret, the same on every instance", key))
+	}
+	return []byte(value)
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if strings.TrimSpace(value) == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if strings.TrimSpace(value) == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load config: %s is incorrect: %s", key, value))
+	}
+	return duration
+}
+
+func getIntOrDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if strings.TrimSpace(value) == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load config: %s is incorrect: %s", key, value))
+	}
+	return number
+}
+
+// getIntInRangeOrDefault reads an integer setting that must lie within
+// [min, max], so that it fits the type it is converted to.
+func getIntInRangeOrDefault(key string, defaultValue, min, max int) int {
+	number := getIntOrDefault(key, defaultValue)
+	if number < min || number > max {
+		panic(fmt.Sprintf("Failed to load config: %s must be between %d and %d: %d", key, min, max, number))
+	}
+	return number
+}
+
+// getOneOfOrDefault reads an enumerated setting. The first allowed value is
+// the default.
+func getOneOfOrDefault(key string, allowed ...string) string {
+	value := getEnvOrDefault(key, allowed[0])
+	for _, candidate := range allowed {
+		if value == candidate {
+			return value
+		}
+	}
+	panic(fmt.Sprintf("Failed to load config: %s must be one of %s: %s", key, strings.Join(allowed, ", "), value))
+}
+
+// getListOrEmpty reads a comma separated list.
+func getListOrEmpty(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getClientScopesOrEmpty parses a comma separated list of
+// client_id:scopes pairs, the scopes separated by spaces. Every client must
+// be one of clients.
+func getClientScopesOrEmpty(key string, clients map[string]string) map[string][]string {
+	scopes := make(map[string][]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, list, found := strings.Cut(pair, ":")
+		if !found || id == "" {
+			panic(fmt.Sprintf("Failed to load config: %s must be a list of client_id:scopes", key))
+		}
+		if _, ok := clients[id]; !ok {
+			panic(fmt.Sprintf("Failed to load config: %s names client %s missing from OAUTH_CLIENTS", key, id))
+		}
+		scopes[id] = strings.Fields(list)
+	}
+	return scopes
+}
+
+// getClientsOrEmpty parses a comma separated list of client_id:client_secret
+// pairs.
+func getClientsOrEmpty(key string) map[string]string {
+	clients := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, found := strings.Cut(pair, ":")
+		if !found || id == "" || secret == "" {
+			panic(fmt.Sprintf("Failed to load config: %s must be a list of client_id:client_secret", key))
+		}
+		clients[id] = secret
+	}
+	return clients
+}
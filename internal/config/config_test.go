@@ -0,0 +1,116 @@
+package config
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// loadWith loads the configuration from the required variables overridden
+// by env, bypassing the one already loaded.
+func loadWith(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+	required := map[string]string{
+		"ACCESS_TOKEN_TTL":     "15m",
+		"DB_DSN":               "unused",
+		"JWT_SECRET":           "test-secret",
+		"WEBHOOK":              "http://127.0.0.1:1/",
+		"REFRESH_TOKEN_PEPPER": "test-pepper",
+	}
+	for key, value := range required {
+		t.Setenv(key, value)
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	once = sync.Once{}
+	cfg = nil
+	t.Cleanup(func() {
+		once = sync.Once{}
+		cfg = nil
+	})
+	return LoadOrError()
+}
+
+func TestLoadRequiresRefreshTokenPepper(t *testing.T) {
+	if _, err := loadWith(t, map[string]string{"REFRESH_TOKEN_PEPPER": ""}); err == nil || !strings.Contains(err.Error(), "REFRESH_TOKEN_PEPPER") {
+		t.Errorf("err = %v, want an error naming REFRESH_TOKEN_PEPPER", err)
+	}
+
+	loaded, err := loadWith(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.RefreshTokenPepper) != "test-pepper" {
+		t.Errorf("pepper = %q, want test-pepper", loaded.RefreshTokenPepper)
+	}
+}
+
+func TestLoadChecksArgon2Bounds(t *testing.T) {
+	loaded, err := loadWith(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Argon2Memory != 64*1024 || loaded.Argon2Iterations != 3 || loaded.Argon2Parallelism != 4 {
+		t.Errorf("argon2 = m=%d,t=%d,p=%d, want m=65536,t=3,p=4", loaded.Argon2Memory, loaded.Argon2Iterations, loaded.Argon2Parallelism)
+	}
+
+	loaded, err = loadWith(t, map[string]string{"PASSWORD_ARGON2_PARALLELISM": "255", "PASSWORD_ARGON2_MEMORY": "2040"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Argon2Parallelism != 255 || loaded.Argon2Memory != 2040 {
+		t.Errorf("argon2 = m=%d,p=%d, want m=2040,p=255", loaded.Argon2Memory, loaded.Argon2Parallelism)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		key  string
+	}{
+		{"parallelism overflowing uint8", map[string]string{"PASSWORD_ARGON2_PARALLELISM": "256"}, "PASSWORD_ARGON2_PARALLELISM"},
+		{"zero parallelism", map[string]string{"PASSWORD_ARGON2_PARALLELISM": "0"}, "PASSWORD_ARGON2_PARALLELISM"},
+		{"memory overflowing uint32", map[string]string{"PASSWORD_ARGON2_MEMORY": "4294967296"}, "PASSWORD_ARGON2_MEMORY"},
+		{"negative memory", map[string]string{"PASSWORD_ARGON2_MEMORY": "-1"}, "PASSWORD_ARGON2_MEMORY"},
+		{"memory below 8 KiB per lane", map[string]string{"PASSWORD_ARGON2_PARALLELISM": "4", "PASSWORD_ARGON2_MEMORY": "31"}, "PASSWORD_ARGON2_MEMORY"},
+		{"zero iterations", map[string]string{"PASSWORD_ARGON2_ITERATIONS": "0"}, "PASSWORD_ARGON2_ITERATIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadWith(t, tt.env); err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("err = %v, want an error naming %s", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestLoadReadsClaimsFileForItsEnricher(t *testing.T) {
+	tests := []struct {
+		name     string
+		enricher string
+		want     string
+	}{
+		{"none", ClaimsEnricherNone, ""},
+		{"static", ClaimsEnricherStatic, "/config/claims.yaml"},
+		{"http fallback", ClaimsEnricherHTTP, "/config/claims.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := loadWith(t, map[string]string{
+				"CLAIMS_ENRICHER": tt.enricher,
+				"CLAIMS_FILE":     "/config/claims.yaml",
+				"CLAIMS_URL":      "http://claims:8082/claims",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.ClaimsFile != tt.want {
+				t.Errorf("claims file = %q, want %q", loaded.ClaimsFile, tt.want)
+			}
+		})
+	}
+
+	if _, err := loadWith(t, map[string]string{"CLAIMS_ENRICHER": ClaimsEnricherStatic, "CLAIMS_FILE": ""}); err == nil || !strings.Contains(err.Error(), "CLAIMS_FILE") {
+		t.Errorf("err = %v, want an error naming CLAIMS_FILE", err)
+	}
+}
@@ -0,0 +1,54 @@
+package dpop
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"sync"
+	"time"
+)
+
+// nonceSource hands out the server nonce of RFC 9449 section 8. The nonce
+// changes every lifetime and the previous one stays valid for another
+// lifetime, so clients that just fetched a nonce are not turned away.
+type nonceSource struct {
+	mu        sync.Mutex
+	lifetime  time.Duration
+	current   string
+	previous  string
+	rotatedAt time.Time
+}
+
+func newNonceSource(lifetime time.Duration) *nonceSource {
+	return &nonceSource{lifetime: lifetime}
+}
+
+func (s *nonceSource) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotate()
+	return s.current
+}
+
+func (s *nonceSource) valid(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotate()
+	return subtle.ConstantTimeCompare([]byte(nonce), []byte(s.current)) == 1 ||
+		(s.previous != "" && subtle.ConstantTimeCompare([]byte(nonce), []byte(s.previous)) == 1)
+}
+
+func (s *nonceSource) rotate() {
+	now := time.Now()
+	if s.current != "" && now.Sub(s.rotatedAt) < s.lifetime {
+		return
+	}
+	if s.current != "" && now.Sub(s.rotatedAt) < 2*s.lifetime {
+		s.previous = s.current
+	} else {
+		s.previous = ""
+	}
+	s.current = rand.Text()
+	s.rotatedAt = now
+}
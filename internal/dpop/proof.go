@@ -0,0 +1,231 @@
+// Package dpop verifies DPoP proofs (RFC 9449): short-lived JWTs signed by
+// a key the client holds, which bind tokens to that key.
+package dpop
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/signing"
+)
+
+const (
+	HeaderProof = "DPoP"
+	HeaderNonce = "DPoP-Nonce"
+
+	proofType = "dpop+jwt"
+)
+
+var (
+	ErrInvalidProof = errors.New("invalid DPoP proof")
+	// ErrUseNonce asks the client to retry with the nonce from the DPoP-Nonce
+	// response header.
+	ErrUseNonce = errors.New("DPoP proof must carry the server nonce")
+)
+
+// ErrorCode returns the RFC 9449 error code for a verification error.
+func ErrorCode(err error) string {
+	if errors.Is(err, ErrUseNonce) {
+		return "use_dpop_nonce"
+	}
+	return "invalid_dpop_proof"
+}
+
+// SupportedAlgorithms lists the asymmetric algorithms accepted for proofs.
+func SupportedAlgorithms() []string {
+	return []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA"}
+}
+
+type proofClaims struct {
+	HTM   string `json:"htm"`
+	HTU   string `json:"htu"`
+	Ath   string `json:"ath,omitempty"`
+	Nonce string `json:"nonce,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Proof is a verified DPoP proof. JKT is the RFC 7638 thumbprint of the key
+// that signed it, which is what tokens are bound to.
+type Proof struct {
+	JKT string
+	ath string
+}
+
+// CoversAccessToken reports whether the ath claim of the proof is the hash
+// of accessToken.
+func (p *Proof) CoversAccessToken(accessToken string) bool {
+	return p.ath != "" && p.ath == accessTokenHash(accessToken)
+}
+
+type Verifier struct {
+	maxAge     time.Duration
+	leeway     time.Duration
+	publicURLs []string
+	replay     *replayCache
+	nonces     *nonceSource
+}
+
+// NewVerifier accepts proofs issued at most maxAge ago, with leeway for
+// clock skew. A zero nonceLifetime disables server nonces. publicURLs are the
+// base URLs clients reach the service at, which may differ from what the
+// request shows behind a proxy; without them the request URL is used.
+func NewVerifier(maxAge, leeway, nonceLifetime time.Duration, publicURLs []string) *Verifier {
+	v := &Verifier{
+		maxAge:     maxAge,
+		leeway:     leeway,
+		publicURLs: publicURLs,
+		replay:     newReplayCache(),
+	}
+	if nonceLifetime > 0 {
+		v.nonces = newNonceSource(nonceLifetime)
+	}
+	return v
+}
+
+// Nonce returns the nonce clients have to put in their next proof, or an
+// empty string when server nonces are disabled.
+func (v *Verifier) Nonce() string {
+	if v.nonces == nil {
+		return ""
+	}
+	return v.nonces.get()
+}
+
+// VerifyRequest checks the DPoP header of r. accessToken is the token the
+// proof is presented with at a resource, and empty at token issuance.
+func (v *Verifier) VerifyRequest(r *http.Request, accessToken string) (*Proof, error) {
+	headers := r.Header.Values(HeaderProof)
+	if len(headers) != 1 {
+		return nil, fmt.Errorf("%w: exactly one %s header is required", ErrInvalidProof, HeaderProof)
+	}
+	return v.Verify(headers[0], r.Method, v.requestURLs(r), accessToken)
+}
+
+// requestURLs lists the URLs the client may have called to reach r: the
+// path of r under every public URL, or the URL r came in with.
+func (v *Verifier) requestURLs(r *http.Request) []string {
+	if len(v.publicURLs) == 0 {
+		return []string{RequestURL(r)}
+	}
+	urls := make([]string, len(v.publicURLs))
+	for i, publicURL := range v.publicURLs {
+		urls[i] = publicURL + r.URL.Path
+	}
+	return urls
+}
+
+// Verify checks a proof for a request with the given method and one of the
+// given URLs, as described in RFC 9449 section 4.3.
+func (v *Verifier) Verify(proof, method string, requestURLs []string, accessToken string) (*Proof, error) {
+	var jkt string
+	claims := &proofClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, fmt.Errorf("typ must be %s", proofType)
+		}
+		jwk, err := headerJWK(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		if jkt, err = signing.Thumbprint(jwk); err != nil {
+			return nil, err
+		}
+		return signing.PublicKeyFromJWK(jwk)
+	}, jwt.WithValidMethods(SupportedAlgorithms()), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: jti and iat are required", ErrInvalidProof)
+	}
+	if claims.HTM != method {
+		return nil, fmt.Errorf("%w: htm does not match the request method", ErrInvalidProof)
+	}
+	if !slices.ContainsFunc(requestURLs, func(requestURL string) bool { return sameURL(claims.HTU, requestURL) }) {
+		return nil, fmt.Errorf("%w: htu does not match the request URL", ErrInvalidProof)
+	}
+	if accessToken != "" && claims.Ath != accessTokenHash(accessToken) {
+		return nil, fmt.Errorf("%w: ath does not match the access token", ErrInvalidProof)
+	}
+
+	now := time.Now()
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.After(now.Add(v.leeway)) || issuedAt.Before(now.Add(-v.maxAge-v.leeway)) {
+		return nil, fmt.Errorf("%w: iat is outside the accepted window", ErrInvalidProof)
+	}
+
+	if v.nonces != nil && !v.nonces.valid(claims.Nonce) {
+		return nil, ErrUseNonce
+	}
+
+	if !v.replay.add(jkt+":"+claims.ID, issuedAt.Add(v.maxAge+v.leeway)) {
+		return nil, fmt.Errorf("%w: proof has already been used", ErrInvalidProof)
+	}
+
+	return &Proof{JKT: jkt, ath: claims.Ath}, nil
+}
+
+// RequestURL rebuilds the URL the client called, without query, to compare
+// with htu. The scheme follows the connection the request came in on, so
+// behind a proxy it is the URL the proxy called.
+func RequestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// headerJWK decodes the jwk header, which must hold a public key only.
+func headerJWK(raw interface{}) (dto.JWK, error) {
+	members, ok := raw.(map[string]interface{})
+	if !ok {
+		return dto.JWK{}, errors.New("jwk header is missing")
+	}
+	if _, ok := members["d"]; ok {
+		return dto.JWK{}, errors.New("jwk header must not contain a private key")
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return dto.JWK{}, err
+	}
+	var jwk dto.JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return dto.JWK{}, fmt.Errorf("invalid jwk header: %w", err)
+	}
+	return jwk, nil
+}
+
+// sameURL compares htu with the request URL ignoring query and fragment,
+// with scheme and host compared case-insensitively.
+func sameURL(htu, requestURL string) bool {
+	got, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	want, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(got.Scheme, want.Scheme) &&
+		strings.EqualFold(got.Host, want.Host) &&
+		got.Path == want.Path
+}
+
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,219 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/signing"
+)
+
+const tokenURL = "https://auth.example.com/api/oauth/token"
+
+type testKey struct {
+	privateKey *ecdsa.PrivateKey
+	jwk        map[string]interface{}
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := signing.PublicKeyToJWK(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members map[string]interface{}
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &members); err != nil {
+		t.Fatal(err)
+	}
+	return testKey{privateKey: privateKey, jwk: members}
+}
+
+// proofClaimsFor returns the claims of a valid proof for a POST to url.
+func proofClaimsFor(url string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti": uuid.NewString(),
+		"htm": http.MethodPost,
+		"htu": url,
+		"iat": time.Now().Unix(),
+	}
+}
+
+func (k testKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = proofType
+	token.Header["jwk"] = k.jwk
+	proof, err := token.SignedString(k.privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestVerify(t *testing.T) {
+	key := newTestKey(t)
+
+	tests := []struct {
+		name        string
+		change      func(claims jwt.MapClaims)
+		accessToken string
+		ok          bool
+	}{
+		{"valid", func(jwt.MapClaims) {}, "", true},
+		{"htu with another case of scheme and host", func(c jwt.MapClaims) { c["htu"] = "HTTPS://Auth.Example.com/api/oauth/token" }, "", true},
+		{"htu with a query", func(c jwt.MapClaims) { c["htu"] = tokenURL + "?x=1" }, "", true},
+		{"htm of another method", func(c jwt.MapClaims) { c["htm"] = http.MethodGet }, "", false},
+		{"htu of another path", func(c jwt.MapClaims) { c["htu"] = "https://auth.example.com/api/oauth/revoke" }, "", false},
+		{"htu of another host", func(c jwt.MapClaims) { c["htu"] = "https://evil.example.com/api/oauth/token" }, "", false},
+		{"htu over http", func(c jwt.MapClaims) { c["htu"] = "http://auth.example.com/api/oauth/token" }, "", false},
+		{"iat too old", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(-2 * time.Minute).Unix() }, "", false},
+		{"iat in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Minute).Unix() }, "", false},
+		{"without iat", func(c jwt.MapClaims) { delete(c, "iat") }, "", false},
+		{"without jti", func(c jwt.MapClaims) { delete(c, "jti") }, "", false},
+		{"ath of the access token", func(c jwt.MapClaims) { c["ath"] = accessTokenHash("token") }, "token", true},
+		{"ath of another access token", func(c jwt.MapClaims) { c["ath"] = accessTokenHash("other") }, "token", false},
+		{"without ath for an access token", func(jwt.MapClaims) {}, "token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewVerifier(time.Minute, 0, 0, nil)
+			claims := proofClaimsFor(tokenURL)
+			tt.change(claims)
+
+			proof, err := verifier.Verify(key.sign(t, claims), http.MethodPost, []string{tokenURL}, tt.accessToken)
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("Verify = %v, want ok = %v", err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidProof)
+			}
+			if tt.accessToken != "" && tt.ok && !proof.CoversAccessToken(tt.accessToken) {
+				t.Error("the proof does not cover its access token")
+			}
+		})
+	}
+}
+
+func TestVerifyChecksHeader(t *testing.T) {
+	key := newTestKey(t)
+	verifier := NewVerifier(time.Minute, 0, 0, nil)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, proofClaimsFor(tokenURL))
+	token.Header["typ"] = "JWT"
+	token.Header["jwk"] = key.jwk
+	proof, err := token.SignedString(key.privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(proof, http.MethodPost, []string{tokenURL}, ""); err == nil {
+		t.Error("a proof with typ JWT was accepted")
+	}
+
+	withPrivateKey := newTestKey(t)
+	withPrivateKey.jwk["d"] = "private"
+	if _, err := verifier.Verify(withPrivateKey.sign(t, proofClaimsFor(tokenURL)), http.MethodPost, []string{tokenURL}, ""); err == nil {
+		t.Error("a proof with a private key in jwk was accepted")
+	}
+
+	// The proof is signed by key, but its jwk header names another key.
+	other := newTestKey(t)
+	other.privateKey = key.privateKey
+	if _, err := verifier.Verify(other.sign(t, proofClaimsFor(tokenURL)), http.MethodPost, []string{tokenURL}, ""); err == nil {
+		t.Error("a proof not signed by its jwk was accepted")
+	}
+}
+
+func TestVerifyRejectsReplayedProof(t *testing.T) {
+	key := newTestKey(t)
+	verifier := NewVerifier(time.Minute, 0, 0, nil)
+	proof := key.sign(t, proofClaimsFor(tokenURL))
+
+	first, err := verifier.Verify(proof, http.MethodPost, []string{tokenURL}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(proof, http.MethodPost, []string{tokenURL}, ""); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("replayed proof: err = %v, want %v", err, ErrInvalidProof)
+	}
+
+	// The jti is only unique per key.
+	claims := proofClaimsFor(tokenURL)
+	claims["jti"] = "shared"
+	if _, err := verifier.Verify(key.sign(t, claims), http.MethodPost, []string{tokenURL}, ""); err != nil {
+		t.Fatal(err)
+	}
+	other, err := verifier.Verify(newTestKey(t).sign(t, claims), http.MethodPost, []string{tokenURL}, "")
+	if err != nil {
+		t.Errorf("the jti of another key was taken as a replay: %v", err)
+	} else if other.JKT == first.JKT {
+		t.Error("proofs of two keys have the same thumbprint")
+	}
+}
+
+func TestVerifyRequiresNonce(t *testing.T) {
+	key := newTestKey(t)
+	verifier := NewVerifier(time.Minute, 0, time.Minute, nil)
+
+	_, err := verifier.Verify(key.sign(t, proofClaimsFor(tokenURL)), http.MethodPost, []string{tokenURL}, "")
+	if !errors.Is(err, ErrUseNonce) || ErrorCode(err) != "use_dpop_nonce" {
+		t.Fatalf("proof without nonce: err = %v, want %v", err, ErrUseNonce)
+	}
+
+	claims := proofClaimsFor(tokenURL)
+	claims["nonce"] = "stale"
+	if _, err := verifier.Verify(key.sign(t, claims), http.MethodPost, []string{tokenURL}, ""); !errors.Is(err, ErrUseNonce) {
+		t.Errorf("proof with an unknown nonce: err = %v, want %v", err, ErrUseNonce)
+	}
+
+	claims = proofClaimsFor(tokenURL)
+	claims["nonce"] = verifier.Nonce()
+	if _, err := verifier.Verify(key.sign(t, claims), http.MethodPost, []string{tokenURL}, ""); err != nil {
+		t.Errorf("proof with the server nonce: %v", err)
+	}
+}
+
+func TestVerifyRequestBehindProxy(t *testing.T) {
+	key := newTestKey(t)
+	// The proxy forwards https://auth.example.com/idp/... to the service.
+	internalURL := "http://10.0.0.5:8080/api/oauth/token"
+	publicURL := "https://auth.example.com/idp/api/oauth/token"
+
+	request := func(htu string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, internalURL, nil)
+		r.Header.Set(HeaderProof, key.sign(t, proofClaimsFor(htu)))
+		return r
+	}
+
+	behindProxy := NewVerifier(time.Minute, 0, 0, []string{"https://auth.example.com/idp", "https://auth.internal"})
+	if _, err := behindProxy.VerifyRequest(request(publicURL), ""); err != nil {
+		t.Errorf("proof for the public URL: %v", err)
+	}
+	if _, err := behindProxy.VerifyRequest(request("https://auth.internal/api/oauth/token"), ""); err != nil {
+		t.Errorf("proof for the second public URL: %v", err)
+	}
+	if _, err := behindProxy.VerifyRequest(request(internalURL), ""); err == nil {
+		t.Error("a proof for the URL the proxy called was accepted")
+	}
+
+	direct := NewVerifier(time.Minute, 0, 0, nil)
+	if _, err := direct.VerifyRequest(request(internalURL), ""); err != nil {
+		t.Errorf("proof for the request URL without public URLs: %v", err)
+	}
+}
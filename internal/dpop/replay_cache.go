@@ -0,0 +1,42 @@
+package dpop
+
+import (
+	"sync"
+	"time"
+)
+
+// replayCache remembers the jti of every accepted proof until the proof
+// would be rejected as too old anyway. Like the refresh grace cache it is
+// local to the instance.
+type replayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextSweep time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: make(map[string]time.Time)}
+}
+
+// add records key until expiresAt and reports false when it is already
+// there.
+func (c *replayCache) add(key string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !now.Before(c.nextSweep) {
+		for seenKey, seenUntil := range c.seen {
+			if !now.Before(seenUntil) {
+				delete(c.seen, seenKey)
+			}
+		}
+		c.nextSweep = now.Add(time.Second)
+	}
+
+	if seenUntil, ok := c.seen[key]; ok && now.Before(seenUntil) {
+		return false
+	}
+	c.seen[key] = expiresAt
+	return true
+}
@@ -0,0 +1,9 @@
+package dto
+
+type LoginRequest struct {
+	Login    string `json:"login" binding:"required" example:"alice"`
+	Password string `json:"password" binding:"required"`
+	ClientID string `json:"client_id,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
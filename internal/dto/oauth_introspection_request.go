@@ -0,0 +1,6 @@
+package dto
+
+type OAuthIntrospectionRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+}
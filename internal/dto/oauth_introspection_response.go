@@ -0,0 +1,31 @@
+package dto
+
+type OAuthIntrospectionResponse struct {
+	Active    bool          `json:"active"`
+	Scope     string        `json:"scope,omitempty"`
+	TokenType string        `json:"token_type,omitempty"`
+	ClientID  string        `json:"client_id,omitempty"`
+	Sub       string        `json:"sub,omitempty"`
+	Exp       int64         `json:"exp,omitempty"`
+	Iat       int64         `json:"iat,omitempty"`
+	Jti       string        `json:"jti,omitempty"`
+	SessionID string        `json:"session_id,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	IP        string        `json:"ip,omitempty"`
+	AuthTime  int64         `json:"auth_time,omitempty"`
+	Act       *Actor        `json:"act,omitempty"`
+	Cnf       *Confirmation `json:"cnf,omitempty"`
+}
+
+// Confirmation is the cnf claim of a sender-constrained token.
+type Confirmation struct {
+	JKT     string `json:"jkt,omitempty"`
+	X5TS256 string `json:"x5t#S256,omitempty"`
+}
+
+// Actor is the RFC 8693 act claim: who acts on behalf of the subject.
+type Actor struct {
+	Sub      string `json:"sub,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Act      *Actor `json:"act,omitempty"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+
+	Username string `form:"username"`
+	Password string `form:"password"`
+
+	SubjectToken       string `form:"subject_token"`
+	SubjectTokenType   string `form:"subject_token_type"`
+	ActorToken         string `form:"actor_token"`
+	ActorTokenType     string `form:"actor_token_type"`
+	RequestedTokenType string `form:"requested_token_type"`
+	RequestedSubject   string `form:"requested_subject"`
+	Audience           string `form:"audience"`
+}
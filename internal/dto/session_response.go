@@ -0,0 +1,23 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SessionResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	Current        bool       `json:"current"`
+	UserAgent      string     `json:"user_agent"`
+	IP             string     `json:"ip"`
+	Scope          string     `json:"scope,omitempty"`
+	ImpersonatedBy *uuid.UUID `json:"impersonated_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     time.Time  `json:"last_used_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
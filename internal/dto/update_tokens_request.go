@@ -1,5 +1,6 @@
 package dto
 
 type UpdateTokensRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
 }
@@ -0,0 +1,5 @@
+package dto
+
+type UserInfoResponse struct {
+	Sub string `json:"sub"`
+}
@@ -2,48 +2,94 @@ package handler
 
 import (
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/dpop"
 	"medods_test_task/internal/dto"
 	"medods_test_task/internal/middleware"
 	"medods_test_task/internal/service/intf"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
 )
 
 type AuthHandler struct {
-	authService intf.AuthService
+	authService     intf.AuthService
+	passwordService intf.PasswordService
+	tokenFormat     tokenFormatIntf.TokenFormat
+	dpopVerifier    *dpop.Verifier
+	cookiePaths     tokenCookiePaths
 }
 
-func NewAuthHandler(authService intf.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService intf.AuthService, passwordService intf.PasswordService, tokenFormat tokenFormatIntf.TokenFormat, dpopVerifier *dpop.Verifier) *AuthHandler {
+	return &AuthHandler{
+		authService:     authService,
+		passwordService: passwordService,
+		tokenFormat:     tokenFormat,
+		dpopVerifier:    dpopVerifier,
+	}
 }
 
 func (h *AuthHandler) RegisterAuthHandlers(router *gin.RouterGroup) {
 	authGroup := router.Group("/auth")
+	h.cookiePaths = tokenCookiePaths{
+		accessToken:  router.BasePath(),
+		refreshToken: authGroup.BasePath() + "/update-tokens",
+	}
 	{
-		authGroup.GET("/create-tokens", h.CreateTokens)
+		switch config.Load().CreateTokens {
+		case config.CreateTokensOpen:
+			authGroup.GET("/create-tokens", h.CreateTokens)
+		case config.CreateTokensClient:
+			authGroup.GET("/create-tokens", middleware.ClientAuthMiddleware(), h.CreateTokens)
+		}
+		authGroup.POST("/login", middleware.RequireJSON(), h.Login)
+	}
+
+	refresh := authGroup.Group("/")
+	refresh.Use(middleware.RefreshAuthMiddleware(h.tokenFormat))
+	{
+		refresh.POST("/update-tokens", middleware.RequireCSRF(), h.UpdateTokens)
 	}
 
 	protected := authGroup.Group("/")
-	protected.Use(middleware.AuthMiddleware(h.authService))
+	protected.Use(middleware.AuthMiddleware(h.authService, h.tokenFormat, h.dpopVerifier))
 	{
-		protected.POST("/update-tokens", h.UpdateTokens)
-		protected.GET("/deauthorize", h.DeauthorizeUser)
+		protected.GET("/deauthorize", middleware.RequireCSRF(), h.DeauthorizeUser)
 		protected.GET("/me", h.GetUserID)
+		protected.POST("/change-password", middleware.RequireCSRF(), h.ChangePassword)
+	}
+
+	// OpenID Connect Core 5.3: UserInfo serves tokens granted openid.
+	userInfo := router.Group("/userinfo")
+	userInfo.Use(middleware.AuthMiddleware(h.authService, h.tokenFormat, h.dpopVerifier), middleware.RequireScopes("openid"))
+	{
+		userInfo.GET("", h.GetUserInfo)
+		userInfo.POST("", h.GetUserInfo)
 	}
 }
 
 // CreateTokens godoc
 // @Summary      Создание access и refresh токенов
-// @Description  Генерирует новые токены по userID
+// @Description  Генерирует новые токены по userID. Вместе с ними выдаётся id_token OpenID Connect, если JWT_ALGORITHM асимметричный. С заголовком DPoP или клиентским TLS-сертификатом токены привязываются к ключу или сертификату. При TOKEN_TRANSPORT=cookie access и refresh токены передаются в HttpOnly cookie вместе с cookie csrf_token, а не в теле ответа. Пользователь проверяется в USER_DIRECTORY: для неизвестного возвращается 404, для отключённого 403, и все его сессии завершаются. При CREATE_TOKENS=client требует аутентификации конфиденциального клиента из OAUTH_CLIENTS через Basic, при CREATE_TOKENS=disabled маршрут отключён. Выдаются только scope, разрешённые клиенту в OAUTH_CLIENT_SCOPES, а без аутентификации клиента - только PUBLIC_CLIENT_SCOPES
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        user_id  query     string  true  "User ID (UUID)"	example(b1506a51-c5a7-45ae-9f2c-4cf700365e46)
+// @Param        user_id    query     string  true   "User ID (UUID)"	example(b1506a51-c5a7-45ae-9f2c-4cf700365e46)
+// @Param        client_id  query     string  false  "OIDC client_id, попадает в aud id_token"
+// @Param        nonce      query     string  false  "OIDC nonce, попадает в id_token"
+// @Param        scope      query     string  false  "Запрашиваемые scope через пробел"
+// @Param        DPoP       header    string  false  "DPoP proof (RFC 9449)"
 // @Success      200      {object}  dto.TokensResponse
 // @Failure      400      {object}  dto.ErrorResponse
+// @Failure      401      {object}  dto.OAuthErrorResponse
+// @Failure      403      {object}  dto.ErrorResponse
+// @Failure      404      {object}  dto.ErrorResponse
+// @Failure      409      {object}  dto.ErrorResponse
 // @Failure      500      {object}  dto.ErrorResponse
 // @Router       /auth/create-tokens [get]
 func (h *AuthHandler) CreateTokens(c *gin.Context) {
@@ -63,84 +109,230 @@ func (h *AuthHandler) CreateTokens(c *gin.Context) {
 		return
 	}
 
+	binding, err := middleware.RequestBinding(c, h.dpopVerifier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, newDPoPErrorResponse(err))
+		return
+	}
+
 	userAgent := c.Request.UserAgent()
 	ip := c.ClientIP()
 
-	accessToken, refreshToken, err := h.authService.CreateTokens(userID, userAgent, ip)
+	// With CREATE_TOKENS=client the session belongs to the authenticated
+	// client rather than to the client_id the caller names.
+	clientID := c.Query("client_id")
+	authenticated := c.GetString("clientID")
+	if authenticated != "" {
+		clientID = authenticated
+	}
+
+	tokens, err := h.authService.CreateTokens(intf.TokenRequest{
+		UserID:              userID,
+		UserAgent:           userAgent,
+		IP:                  ip,
+		ClientID:            clientID,
+		ClientAuthenticated: authenticated != "",
+		Nonce:               c.Query("nonce"),
+		Scopes:              utils.ParseScope(c.Query("scope")),
+		Binding:             binding,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, intf.ErrSessionLimitReached):
+			status = http.StatusConflict
+		case errors.Is(err, intf.ErrInvalidScope):
+			status = http.StatusBadRequest
+		case errors.Is(err, intf.ErrUserNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, intf.ErrUserDisabled):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, newErrorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.tokensResponse(c, tokens))
+}
+
+// Login godoc
+// @Summary      Вход по логину и паролю
+// @Description  Проверяет пароль и выдаёт токены так же, как create-tokens: с id_token, привязкой к DPoP или сертификату и проверкой USER_DIRECTORY. Пароли хранятся в виде хешей Argon2id; хеш с устаревшими параметрами пересчитывается при входе. Неизвестный логин и неверный пароль неразличимы ни по ответу, ни по времени. При TOKEN_TRANSPORT=cookie принимает только Content-Type: application/json
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        loginRequest  body    dto.LoginRequest  true   "Логин и пароль"
+// @Param        DPoP          header  string            false  "DPoP proof (RFC 9449)"
+// @Success      200  {object}  dto.TokensResponse
+// @Failure      400  {object}  dto.ErrorResponse
+// @Failure      401  {object}  dto.ErrorResponse
+// @Failure      403  {object}  dto.ErrorResponse
+// @Failure      404  {object}  dto.ErrorResponse
+// @Failure      409  {object}  dto.ErrorResponse
+// @Failure      415  {object}  dto.ErrorResponse
+// @Failure      500  {object}  dto.ErrorResponse
+// @Failure      503  {object}  dto.ErrorResponse
+// @Router       /auth/login [post]
+func (h *AuthHandler) Login(c *gin.Context) {
+	var input dto.LoginRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.TokensResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+	binding, err := middleware.RequestBinding(c, h.dpopVerifier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, newDPoPErrorResponse(err))
+		return
+	}
+
+	tokens, err := h.passwordService.Login(intf.LoginRequest{
+		Login:    input.Login,
+		Password: input.Password,
+		TokenRequest: intf.TokenRequest{
+			UserAgent: c.Request.UserAgent(),
+			IP:        c.ClientIP(),
+			ClientID:  input.ClientID,
+			Nonce:     input.Nonce,
+			Scopes:    utils.ParseScope(input.Scope),
+			Binding:   binding,
+		},
 	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, intf.ErrInvalidCredentials):
+			status = http.StatusUnauthorized
+		case errors.Is(err, intf.ErrPasswordCheckBusy):
+			status = http.StatusServiceUnavailable
+			c.Header("Retry-After", "1")
+		case errors.Is(err, intf.ErrSessionLimitReached):
+			status = http.StatusConflict
+		case errors.Is(err, intf.ErrInvalidScope):
+			status = http.StatusBadRequest
+		case errors.Is(err, intf.ErrUserNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, intf.ErrUserDisabled):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, newErrorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.tokensResponse(c, tokens))
 }
 
 // UpdateTokens godoc
 // @Summary      Обновление access и refresh токенов
-// @Description  Обновляет токены по access и refresh токенам
+// @Description  Обновляет токены по refresh токену вида <id>.<secret>. Access токен необязателен и может быть просрочен; для refresh токенов старого формата без id он обязателен. Поле scope может только сузить scope нового access токена. Привязанный refresh токен обновляется только с DPoP proof того же ключа или тем же клиентским сертификатом. При TOKEN_TRANSPORT=cookie refresh токен берётся из cookie, если не передан в теле, а запрос с cookie требует заголовка X-CSRF-Token
 // @Tags         auth
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        updateTokensRequest  body  dto.UpdateTokensRequest  true  "Refresh Token Input"
+// @Param        DPoP                 header  string  false  "DPoP proof (RFC 9449)"
+// @Param        X-CSRF-Token         header  string  false  "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)"
 // @Success      200   {object}  dto.TokensResponse
 // @Failure      400   {object}  dto.ErrorResponse
 // @Failure      401   {object}  dto.ErrorResponse
+// @Failure      403   {object}  dto.ErrorResponse
+// @Failure      409   {object}  dto.ErrorResponse
 // @Failure      500   {object}  dto.ErrorResponse
 // @Security     BearerAuth
 // @Router       /auth/update-tokens [post]
 func (h *AuthHandler) UpdateTokens(c *gin.Context) {
 	var input dto.UpdateTokensRequest
-	if err := c.ShouldBindJSON(&input); err != nil {
+	// In the cookie transport the body may be omitted altogether.
+	if err := c.ShouldBindJSON(&input); err != nil && !(cookieTransport() && errors.Is(err, io.EOF)) {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
 	}
+	if input.RefreshToken == "" && cookieTransport() {
+		input.RefreshToken, _ = c.Cookie(middleware.CookieRefreshToken)
+	}
+	if input.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: "refresh_token is required",
+		})
+		return
+	}
+
+	// The access token is optional on this route; without it the ID comes
+	// from the refresh token itself.
+	refreshTokenID, _ := getRefreshTokenIDFromContext(c)
 
-	refreshTokenID, err := h.getRefreshTokenIDFromContext(c)
+	binding, err := middleware.RequestBinding(c, h.dpopVerifier)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error: err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, newDPoPErrorResponse(err))
 		return
 	}
 
 	userAgent := c.Request.UserAgent()
 	ip := c.ClientIP()
 
-	accessToken, refreshToken, err := h.authService.UpdateTokens(refreshTokenID, input.RefreshToken, userAgent, ip)
+	tokens, err := h.authService.UpdateTokens(intf.RefreshRequest{
+		RefreshTokenID: refreshTokenID,
+		RefreshToken:   input.RefreshToken,
+		UserAgent:      userAgent,
+		IP:             ip,
+		Scopes:         utils.ParseScope(input.Scope),
+		Binding:        binding,
+	})
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Error: err.Error(),
-		})
+		status := http.StatusUnauthorized
+		switch {
+		case errors.Is(err, intf.ErrInvalidScope):
+			status = http.StatusBadRequest
+		case errors.Is(err, intf.ErrRefreshConflict):
+			status = http.StatusConflict
+		}
+		c.JSON(status, newErrorResponse(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.TokensResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	})
+	c.JSON(http.StatusOK, h.tokensResponse(c, tokens))
+}
+
+// tokensResponse returns tokens in the body or, in the cookie transport,
+// sets them as cookies and leaves them out of the body.
+func (h *AuthHandler) tokensResponse(c *gin.Context, tokens *intf.Tokens) dto.TokensResponse {
+	response := newTokensResponse(tokens)
+	if cookieTransport() {
+		setTokenCookies(c, h.cookiePaths, tokens)
+		response.AccessToken = ""
+		response.RefreshToken = ""
+	}
+	return response
+}
+
+func newTokensResponse(tokens *intf.Tokens) dto.TokensResponse {
+	return dto.TokensResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        utils.FormatScope(tokens.Scopes),
+	}
 }
 
 // DeauthorizeUser godoc
 // @Summary      Деавторизация пользователя
-// @Description  Деактивирует все refresh токены по userID
+// @Description  Деактивирует все refresh токены по userID. При TOKEN_TRANSPORT=cookie удаляет cookie с токенами, а запрос с cookie требует заголовка X-CSRF-Token
 // @Tags         auth
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
+// @Param        X-CSRF-Token  header  string  false  "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)"
 // @Success      200  {object}  dto.MessageResponse
+// @Failure      403  {object}  dto.ErrorResponse
 // @Failure      500  {object}  dto.ErrorResponse
 // @Security     BearerAuth
 // @Router       /auth/deauthorize [get]
 func (h *AuthHandler) DeauthorizeUser(c *gin.Context) {
-	refreshTokenID, err := h.getRefreshTokenIDFromContext(c)
+	userID, err := getUserIDFromContext(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: err.Error(),
@@ -148,22 +340,88 @@ func (h *AuthHandler) DeauthorizeUser(c *gin.Context) {
 		return
 	}
 
-	userID, err := h.authService.GetUserIDByRefreshTokenID(refreshTokenID)
+	if err := h.authService.DeauthorizeUser(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if cookieTransport() {
+		clearTokenCookies(c, h.cookiePaths)
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{
+		Message: "user deauthorized",
+	})
+}
+
+// ChangePassword godoc
+// @Summary      Смена пароля
+// @Description  Меняет пароль после проверки текущего и завершает все остальные сессии пользователя. Недоступна в сессии имперсонации. Новый пароль должен быть не короче PASSWORD_MIN_LENGTH символов. При TOKEN_TRANSPORT=cookie запрос с cookie требует заголовка X-CSRF-Token
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        changePasswordRequest  body    dto.ChangePasswordRequest  true   "Текущий и новый пароль"
+// @Param        X-CSRF-Token           header  string                     false  "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)"
+// @Success      200  {object}  dto.MessageResponse
+// @Failure      400  {object}  dto.ErrorResponse
+// @Failure      401  {object}  dto.ErrorResponse
+// @Failure      403  {object}  dto.ErrorResponse
+// @Failure      500  {object}  dto.ErrorResponse
+// @Failure      503  {object}  dto.ErrorResponse
+// @Router       /auth/change-password [post]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var input dto.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	userID, err := getUserIDFromContext(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: err.Error(),
 		})
+		return
 	}
 
-	if err := h.authService.DeauthorizeUser(userID); err != nil {
+	refreshTokenID, err := getRefreshTokenIDFromContext(c)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
 	}
 
+	err = h.passwordService.ChangePassword(intf.PasswordChangeRequest{
+		UserID:          userID,
+		RefreshTokenID:  refreshTokenID,
+		CurrentPassword: input.CurrentPassword,
+		NewPassword:     input.NewPassword,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, intf.ErrPasswordTooShort):
+			status = http.StatusBadRequest
+		case errors.Is(err, intf.ErrInvalidCredentials):
+			status = http.StatusUnauthorized
+		case errors.Is(err, intf.ErrPasswordCheckBusy):
+			status = http.StatusServiceUnavailable
+			c.Header("Retry-After", "1")
+		case errors.Is(err, intf.ErrImpersonatedSession):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, newErrorResponse(err))
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.MessageResponse{
-		Message: "user deauthorized",
+		Message: "password changed",
 	})
 }
 
@@ -179,7 +437,7 @@ func (h *AuthHandler) DeauthorizeUser(c *gin.Context) {
 // @Security     BearerAuth
 // @Router       /auth/me [get]
 func (h *AuthHandler) GetUserID(c *gin.Context) {
-	refreshTokenID, err := h.getRefreshTokenIDFromContext(c)
+	userID, err := getUserIDFromContext(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: err.Error(),
@@ -187,19 +445,37 @@ func (h *AuthHandler) GetUserID(c *gin.Context) {
 		return
 	}
 
-	userID, err := h.authService.GetUserIDByRefreshTokenID(refreshTokenID)
+	c.JSON(http.StatusOK, dto.UserIDResponse{
+		UserID: userID,
+	})
+}
+
+// GetUserInfo godoc
+// @Summary      UserInfo OpenID Connect
+// @Description  Возвращает claims пользователя по access токену со scope openid. Аналог /auth/me в формате OpenID Connect
+// @Tags         oidc
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  dto.UserInfoResponse
+// @Failure      401  {object}  dto.ErrorResponse
+// @Failure      403  {object}  dto.ErrorResponse
+// @Failure      500  {object}  dto.ErrorResponse
+// @Router       /userinfo [get]
+func (h *AuthHandler) GetUserInfo(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: err.Error(),
 		})
+		return
 	}
 
-	c.JSON(http.StatusOK, dto.UserIDResponse{
-		UserID: userID,
+	c.JSON(http.StatusOK, dto.UserInfoResponse{
+		Sub: userID.String(),
 	})
 }
 
-func (h *AuthHandler) getRefreshTokenIDFromContext(c *gin.Context) (uuid.UUID, error) {
+func getRefreshTokenIDFromContext(c *gin.Context) (uuid.UUID, error) {
 	refreshTokenIDVal, exists := c.Get("refreshTokenID")
 	if !exists {
 		return uuid.Nil, errors.New("refreshTokenID not found in context")
@@ -212,3 +488,17 @@ func (h *AuthHandler) getRefreshTokenIDFromContext(c *gin.Context) (uuid.UUID, e
 
 	return refreshTokenID, nil
 }
+
+func getUserIDFromContext(c *gin.Context) (uuid.UUID, error) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		return uuid.Nil, errors.New("userID not found in context")
+	}
+
+	userID, ok := userIDVal.(uuid.UUID)
+	if !ok {
+		return uuid.Nil, errors.New("invalid userID type")
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/utils"
+)
+
+// IsTokenValid treats every session that was not revoked as active.
+func (s *recordingAuthService) IsTokenValid(refreshTokenID uuid.UUID) (bool, error) {
+	return !slices.Contains(s.revoked, refreshTokenID), nil
+}
+
+func TestUserInfoRequiresOpenIDScope(t *testing.T) {
+	format := newTestTokenFormat(t)
+	h := NewAuthHandler(&recordingAuthService{}, nil, format, dpop.NewVerifier(time.Minute, 0, 0, nil))
+	router := gin.New()
+	h.RegisterAuthHandlers(router.Group("/"))
+
+	tests := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{"openid", []string{"openid", "profile"}, http.StatusOK},
+		{"without openid", []string{"profile"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := format.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+				UserID:         uuid.New(),
+				RefreshTokenID: uuid.New(),
+				Scopes:         tt.scopes,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"crypto/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/middleware"
+	"medods_test_task/internal/service/intf"
+)
+
+// tokenCookiePaths limits where the browser sends each token cookie: the
+// access token goes to every API route, the refresh token only to the
+// refresh route.
+type tokenCookiePaths struct {
+	accessToken  string
+	refreshToken string
+}
+
+func cookieTransport() bool {
+	return config.Load().TokenTransport == config.TokenTransportCookie
+}
+
+// setTokenCookies hands the tokens to the browser as HttpOnly cookies,
+// together with a new CSRF token that scripts can read and send back in
+// the X-CSRF-Token header.
+func setTokenCookies(c *gin.Context, paths tokenCookiePaths, tokens *intf.Tokens) {
+	cfg := config.Load()
+	setCookie(c, middleware.CookieAccessToken, tokens.AccessToken, paths.accessToken, cfg.AccessTokenTTL, true)
+	setCookie(c, middleware.CookieRefreshToken, tokens.RefreshToken, paths.refreshToken, cfg.RefreshTokenTTL, true)
+	setCookie(c, middleware.CookieCSRFToken, rand.Text(), "/", cfg.RefreshTokenTTL, false)
+}
+
+// clearTokenCookies makes the browser drop the cookies set by
+// setTokenCookies.
+func clearTokenCookies(c *gin.Context, paths tokenCookiePaths) {
+	setCookie(c, middleware.CookieAccessToken, "", paths.accessToken, -1, true)
+	setCookie(c, middleware.CookieRefreshToken, "", paths.refreshToken, -1, true)
+	setCookie(c, middleware.CookieCSRFToken, "", "/", -1, false)
+}
+
+func setCookie(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	cfg := config.Load()
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(cfg.CookieSameSite),
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+func cookieSameSite(sameSite string) http.SameSite {
+	switch sameSite {
+	case config.CookieSameSiteLax:
+		return http.SameSiteLaxMode
+	case config.CookieSameSiteNone:
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
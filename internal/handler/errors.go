@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/service/intf"
+)
+
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{intf.ErrRefreshTokenNotFound, "refresh_token_not_found"},
+	{intf.ErrInvalidRefreshToken, "invalid_refresh_token"},
+	{intf.ErrRefreshTokenReused, "refresh_token_reused"},
+	{intf.ErrRefreshTokenExpired, "refresh_token_expired"},
+	{intf.ErrUserAgentMismatch, "user_agent_mismatch"},
+	{intf.ErrTokenBindingMismatch, "token_binding_mismatch"},
+	{intf.ErrRefreshConflict, "refresh_conflict"},
+	{intf.ErrClientMismatch, "client_mismatch"},
+	{intf.ErrRefreshTokenIDMissing, "refresh_token_id_missing"},
+	{intf.ErrSessionNotFound, "session_not_found"},
+	{intf.ErrSessionLimitReached, "session_limit_reached"},
+	{intf.ErrInvalidScope, "invalid_scope"},
+	{intf.ErrUserNotFound, "user_not_found"},
+	{intf.ErrUserDisabled, "user_disabled"},
+	{intf.ErrInvalidCredentials, "invalid_credentials"},
+	{intf.ErrPasswordTooShort, "password_too_short"},
+	{intf.ErrImpersonatedSession, "impersonated_session"},
+	{intf.ErrPasswordCheckBusy, "password_check_busy"},
+}
+
+// newErrorResponse builds an error body and attaches a machine readable
+// code when err is one of the known service errors.
+func newErrorResponse(err error) dto.ErrorResponse {
+	response := dto.ErrorResponse{Error: err.Error()}
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			response.Code = known.code
+			break
+		}
+	}
+	return response
+}
+
+// newDPoPErrorResponse reports a rejected DPoP proof with its RFC 9449 code.
+func newDPoPErrorResponse(err error) dto.ErrorResponse {
+	return dto.ErrorResponse{Error: err.Error(), Code: dpop.ErrorCode(err)}
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/signing"
+)
+
+type JWKSHandler struct {
+	keyring *signing.Keyring
+}
+
+func NewJWKSHandler(keyring *signing.Keyring) *JWKSHandler {
+	return &JWKSHandler{keyring: keyring}
+}
+
+func (h *JWKSHandler) RegisterJWKSHandlers(router gin.IRoutes) {
+	router.GET("/.well-known/jwks.json", h.GetJWKS)
+}
+
+// GetJWKS serves the public signing keys so resource servers can verify
+// access tokens without the secret. It lives outside /api and therefore
+// outside the swagger spec. Verify-only keys are listed next to the active
+// one so tokens signed before a rotation still verify. With HS512 the key
+// set is empty.
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	keys, err := h.keyring.PublicJWKs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(signing.JWKSMaxAge.Seconds())))
+	c.JSON(http.StatusOK, dto.JWKSResponse{Keys: keys})
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/signing"
+)
+
+func getJWKS(t *testing.T, keyring *signing.Keyring) (*httptest.ResponseRecorder, dto.JWKSResponse) {
+	t.Helper()
+	router := gin.New()
+	NewJWKSHandler(keyring).RegisterJWKSHandlers(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var body dto.JWKSResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return rec, body
+}
+
+func TestJWKSPublishesVerifyingKeys(t *testing.T) {
+	keyring, err := signing.OpenKeyring(t.TempDir(), signing.AlgorithmES256, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := keyring.Active()
+	staged, err := keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, body := getJWKS(t, keyring)
+
+	if got, want := rec.Header().Get("Cache-Control"), "public, max-age=300"; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+	if len(body.Keys) != 2 || body.Keys[0].Kid != active.ID || body.Keys[1].Kid != staged.KID {
+		t.Fatalf("keys = %+v, want the active key %s followed by the staged key %s", body.Keys, active.ID, staged.KID)
+	}
+	for _, jwk := range body.Keys {
+		if jwk.Kty != "EC" || jwk.Crv != "P-256" || jwk.Alg != signing.AlgorithmES256 || jwk.Use != "sig" {
+			t.Errorf("key %s = %+v, want a P-256 signing key", jwk.Kid, jwk)
+		}
+	}
+
+	// A resource server holding only the published key verifies a token.
+	token, err := jwt.NewWithClaims(active.Method, jwt.MapClaims{"sub": "user"}).SignedString(active.SignKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := signing.PublicKeyFromJWK(body.Keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return publicKey, nil },
+		jwt.WithValidMethods([]string{signing.AlgorithmES256})); err != nil {
+		t.Errorf("token does not verify with the published key: %v", err)
+	}
+}
+
+func TestJWKSIsEmptyForSymmetricKey(t *testing.T) {
+	key, err := signing.NewSymmetricKey([]byte("test-secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, body := getJWKS(t, signing.NewStaticKeyring(key))
+
+	if body.Keys == nil || len(body.Keys) != 0 {
+		t.Errorf("keys = %v, want an empty list", body.Keys)
+	}
+	if rec.Body.String() != `{"keys":[]}` {
+		t.Errorf("body = %s, want {\"keys\":[]}", rec.Body.String())
+	}
+}
@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/middleware"
+	"medods_test_task/internal/service/intf"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+const (
+	GrantTypeRefreshToken = "refresh_token"
+	GrantTypePassword     = "password"
+)
+
+// oauthError is an RFC 6749 section 5.2 error together with the HTTP status
+// it is returned with.
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{status: status, code: code, description: description}
+}
+
+// grantHandler issues tokens for one grant_type.
+type grantHandler func(c *gin.Context, input *dto.OAuthTokenRequest) (*dto.OAuthTokenResponse, *oauthError)
+
+type OAuthHandler struct {
+	authService     intf.AuthService
+	passwordService intf.PasswordService
+	tokenFormat     tokenFormatIntf.TokenFormat
+	dpopVerifier    *dpop.Verifier
+	grants          map[string]grantHandler
+}
+
+func NewOAuthHandler(authService intf.AuthService, passwordService intf.PasswordService, tokenFormat tokenFormatIntf.TokenFormat, dpopVerifier *dpop.Verifier) *OAuthHandler {
+	h := &OAuthHandler{
+		authService:     authService,
+		passwordService: passwordService,
+		tokenFormat:     tokenFormat,
+		dpopVerifier:    dpopVerifier,
+	}
+	h.grants = map[string]grantHandler{
+		GrantTypeRefreshToken:  h.refreshTokenGrant,
+		GrantTypePassword:      h.passwordGrant,
+		GrantTypeTokenExchange: h.tokenExchangeGrant,
+	}
+	return h
+}
+
+func (h *OAuthHandler) RegisterOAuthHandlers(router *gin.RouterGroup) {
+	oauthGroup := router.Group("/oauth")
+	{
+		oauthGroup.POST("/token", h.Token)
+		oauthGroup.POST("/revoke", h.Revoke)
+	}
+
+	clientAuthenticated := oauthGroup.Group("/")
+	clientAuthenticated.Use(middleware.ClientAuthMiddleware())
+	{
+		clientAuthenticated.POST("/introspect", h.Introspect)
+	}
+}
+
+// Token godoc
+// @Summary      Токен-эндпоинт OAuth 2.0
+// @Description  Выдаёт токены по RFC 6749. Поддерживаются grant_type=refresh_token, password и обмен токенов по RFC 8693 (urn:ietf:params:oauth:grant-type:token-exchange, требует аутентификации клиента). Конфиденциальный клиент из OAUTH_CLIENTS аутентифицируется через Basic или client_id/client_secret, и его refresh токены принимаются только от него. При grant_type=password выдаются только scope из OAUTH_CLIENT_SCOPES аутентифицированного клиента или PUBLIC_CLIENT_SCOPES для публичного. С заголовком DPoP или клиентским TLS-сертификатом токены привязываются к ключу или сертификату, token_type привязанных к DPoP токенов - DPoP. Привязанные subject_token и actor_token при обмене требуют proof того же ключа (с ath обмениваемого токена) или того же сертификата
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        grant_type            formData  string  true   "Grant type"  Enums(refresh_token, password, urn:ietf:params:oauth:grant-type:token-exchange)
+// @Param        refresh_token         formData  string  false  "Refresh token (для grant_type=refresh_token)"
+// @Param        username              formData  string  false  "Логин (для grant_type=password)"
+// @Param        password              formData  string  false  "Пароль (для grant_type=password)"
+// @Param        client_id             formData  string  false  "Client ID"
+// @Param        client_secret         formData  string  false  "Client secret конфиденциального клиента"
+// @Param        scope                 formData  string  false  "Scope"
+// @Param        subject_token         formData  string  false  "Access token, который обменивается, или ID пользователя для имперсонации (для token-exchange)"
+// @Param        subject_token_type    formData  string  false  "Тип subject_token"  Enums(urn:ietf:params:oauth:token-type:access_token, urn:medods:params:oauth:token-type:user_id)
+// @Param        actor_token           formData  string  false  "Access token сотрудника, выполняющего имперсонацию"
+// @Param        actor_token_type      formData  string  false  "Тип actor_token"  Enums(urn:ietf:params:oauth:token-type:access_token)
+// @Param        requested_token_type  formData  string  false  "Тип запрашиваемого токена"  Enums(urn:ietf:params:oauth:token-type:access_token)
+// @Param        requested_subject     formData  string  false  "Устаревшее расширение: ID пользователя для имперсонации, subject_token - токен сотрудника"
+// @Param        audience              formData  string  false  "Audience запрашиваемого токена"
+// @Param        DPoP                  header    string  false  "DPoP proof (RFC 9449)"
+// @Success      200  {object}  dto.OAuthTokenResponse
+// @Failure      400  {object}  dto.OAuthErrorResponse
+// @Failure      401  {object}  dto.OAuthErrorResponse
+// @Failure      403  {object}  dto.OAuthErrorResponse
+// @Failure      500  {object}  dto.OAuthErrorResponse
+// @Failure      503  {object}  dto.OAuthErrorResponse
+// @Router       /oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var input dto.OAuthTokenRequest
+	if err := c.ShouldBind(&input); err != nil {
+		h.abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+
+	grant, ok := h.grants[input.GrantType]
+	if !ok {
+		h.abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type "+input.GrantType+" is not supported"))
+		return
+	}
+
+	response, oauthErr := grant(c, &input)
+	if oauthErr != nil {
+		h.abortWithOAuthError(c, oauthErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *OAuthHandler) refreshTokenGrant(c *gin.Context, input *dto.OAuthTokenRequest) (*dto.OAuthTokenResponse, *oauthError) {
+	if input.RefreshToken == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+
+	clientID, _, oauthErr := requestClient(c)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	binding, err := middleware.RequestBinding(c, h.dpopVerifier)
+	if err != nil {
+		return nil, newDPoPOAuthError(err)
+	}
+
+	tokens, err := h.authService.UpdateTokens(intf.RefreshRequest{
+		RefreshToken: input.RefreshToken,
+		UserAgent:    c.Request.UserAgent(),
+		IP:           c.ClientIP(),
+		ClientID:     clientID,
+		Scopes:       utils.ParseScope(input.Scope),
+		Binding:      binding,
+	})
+	if err != nil {
+		return nil, oauthErrorFromService(err)
+	}
+
+	return newOAuthTokenResponse(tokens), nil
+}
+
+// passwordGrant implements the resource owner password credentials grant
+// (RFC 6749 section 4.3) on top of the password login. The session is
+// issued to the calling client.
+func (h *OAuthHandler) passwordGrant(c *gin.Context, input *dto.OAuthTokenRequest) (*dto.OAuthTokenResponse, *oauthError) {
+	if input.Username == "" || input.Password == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "username and password are required")
+	}
+
+	clientID, authenticated, oauthErr := requestClient(c)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	binding, err := middleware.RequestBinding(c, h.dpopVerifier)
+	if err != nil {
+		return nil, newDPoPOAuthError(err)
+	}
+
+	tokens, err := h.passwordService.Login(intf.LoginRequest{
+		Login:    input.Username,
+		Password: input.Password,
+		TokenRequest: intf.TokenRequest{
+			UserAgent:           c.Request.UserAgent(),
+			IP:                  c.ClientIP(),
+			ClientID:            clientID,
+			ClientAuthenticated: authenticated,
+			Scopes:              utils.ParseScope(input.Scope),
+			Binding:             binding,
+		},
+	})
+	if err != nil {
+		return nil, oauthErrorFromService(err)
+	}
+
+	return newOAuthTokenResponse(tokens), nil
+}
+
+// requestClient identifies the client of a token request and reports whether
+// it authenticated. Credentials, when sent, must be valid. A bare client_id
+// identifies a public client, so a confidential client from OAUTH_CLIENTS
+// cannot omit its secret.
+func requestClient(c *gin.Context) (string, bool, *oauthError) {
+	_, _, hasBasicAuth := c.Request.BasicAuth()
+	if hasBasicAuth || c.PostForm("client_secret") != "" {
+		clientID, ok := middleware.AuthenticateClient(c)
+		if !ok {
+			return "", false, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+		return clientID, true, nil
+	}
+
+	clientID := c.PostForm("client_id")
+	if _, confidential := config.Load().OAuthClients[clientID]; confidential {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		return "", false, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication required")
+	}
+	return clientID, false, nil
+}
+
+func newOAuthTokenResponse(tokens *intf.Tokens) *dto.OAuthTokenResponse {
+	tokenType := "Bearer"
+	if tokens.Binding.JKT != "" {
+		tokenType = "DPoP"
+	}
+	return &dto.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokenType,
+		ExpiresIn:    int64(config.Load().AccessTokenTTL.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        utils.FormatScope(tokens.Scopes),
+	}
+}
+
+// oauthErrorFromService maps service errors about the presented grant to
+// invalid_grant, scope errors to invalid_scope, a lost concurrent rotation
+// and a full password hashing queue to the retryable temporarily_unavailable
+// and everything else to server_error.
+func oauthErrorFromService(err error) *oauthError {
+	if errors.Is(err, intf.ErrInvalidScope) {
+		return newOAuthError(http.StatusBadRequest, "invalid_scope", err.Error())
+	}
+	if errors.Is(err, intf.ErrRefreshConflict) || errors.Is(err, intf.ErrPasswordCheckBusy) {
+		return newOAuthError(http.StatusServiceUnavailable, "temporarily_unavailable", err.Error())
+	}
+	grantErrors := []error{
+		intf.ErrRefreshTokenNotFound,
+		intf.ErrInvalidRefreshToken,
+		intf.ErrRefreshTokenReused,
+		intf.ErrRefreshTokenExpired,
+		intf.ErrRefreshTokenIDMissing,
+		intf.ErrUserAgentMismatch,
+		intf.ErrTokenBindingMismatch,
+		intf.ErrClientMismatch,
+		intf.ErrInvalidCredentials,
+		intf.ErrSessionLimitReached,
+		intf.ErrUserNotFound,
+		intf.ErrUserDisabled,
+	}
+	for _, grantErr := range grantErrors {
+		if errors.Is(err, grantErr) {
+			return newOAuthError(http.StatusBadRequest, "invalid_grant", grantErr.Error())
+		}
+	}
+	return newOAuthError(http.StatusInternalServerError, "server_error", err.Error())
+}
+
+// newDPoPOAuthError reports a rejected DPoP proof of a token request.
+func newDPoPOAuthError(err error) *oauthError {
+	return newOAuthError(http.StatusBadRequest, dpop.ErrorCode(err), err.Error())
+}
+
+func (h *OAuthHandler) abortWithOAuthError(c *gin.Context, err *oauthError) {
+	c.AbortWithStatusJSON(err.status, dto.OAuthErrorResponse{
+		Error:            err.code,
+		ErrorDescription: err.description,
+	})
+}
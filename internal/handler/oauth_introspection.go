@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/middleware"
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/utils"
+)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// Introspect godoc
+// @Summary      Интроспекция токена
+// @Description  Возвращает состояние access или refresh токена по RFC 7662. Требует аутентификации клиента (Basic или client_id/client_secret)
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string  true   "Access или refresh токен"
+// @Param        token_type_hint  formData  string  false  "Подсказка о типе токена"  Enums(access_token, refresh_token)
+// @Success      200  {object}  dto.OAuthIntrospectionResponse
+// @Failure      400  {object}  dto.OAuthErrorResponse
+// @Failure      401  {object}  dto.OAuthErrorResponse
+// @Router       /oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var input dto.OAuthIntrospectionRequest
+	if err := c.ShouldBind(&input); err != nil {
+		h.abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+
+	// The hint only decides which lookup runs first, as RFC 7662 allows.
+	lookups := []func(string) (dto.OAuthIntrospectionResponse, bool){h.introspectAccessToken, h.introspectRefreshToken}
+	if input.TokenTypeHint == TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		if response, ok := lookup(input.Token); ok {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, dto.OAuthIntrospectionResponse{Active: false})
+}
+
+// introspectAccessToken reports ok when token is a correctly signed access
+// token, whether or not it is still active.
+func (h *OAuthHandler) introspectAccessToken(token string) (dto.OAuthIntrospectionResponse, bool) {
+	claims, err := middleware.ParseAccessToken(token, h.tokenFormat)
+	if err != nil {
+		return dto.OAuthIntrospectionResponse{}, false
+	}
+
+	isActive, err := h.authService.IsTokenValid(claims.RefreshTokenID)
+	if err != nil || !isActive {
+		return dto.OAuthIntrospectionResponse{Active: false}, true
+	}
+
+	session, err := h.authService.GetSession(claims.RefreshTokenID)
+	if err != nil {
+		return dto.OAuthIntrospectionResponse{Active: false}, true
+	}
+
+	response := sessionIntrospection(session)
+	response.TokenType = TokenTypeHintAccessToken
+	response.Scope = claims.Scope
+	response.Act = newActor(claims.Act)
+	// An exchanged token is issued to the exchanging client, not to the
+	// client of the session it belongs to.
+	if claims.Act != nil && claims.Act.ClientID != "" {
+		response.ClientID = claims.Act.ClientID
+	}
+	response.Cnf = newConfirmation(claims.Cnf)
+	response.Jti = claims.ID
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+	return response, true
+}
+
+// introspectRefreshToken reports ok when token is a known refresh token with
+// a matching secret.
+func (h *OAuthHandler) introspectRefreshToken(token string) (dto.OAuthIntrospectionResponse, bool) {
+	session, active, err := h.authService.InspectRefreshToken(token)
+	if err != nil {
+		return dto.OAuthIntrospectionResponse{}, false
+	}
+	if !active {
+		return dto.OAuthIntrospectionResponse{Active: false}, true
+	}
+
+	response := sessionIntrospection(session)
+	response.TokenType = TokenTypeHintRefreshToken
+	response.Scope = session.Scope
+	response.Jti = session.ID.String()
+	response.Iat = session.CreatedAt.Unix()
+	if session.ExpiresAt != nil {
+		response.Exp = session.ExpiresAt.Unix()
+	}
+	return response, true
+}
+
+func sessionIntrospection(session *model.RefreshToken) dto.OAuthIntrospectionResponse {
+	response := dto.OAuthIntrospectionResponse{
+		Active:    true,
+		Sub:       session.UserID.String(),
+		ClientID:  session.ClientID,
+		SessionID: session.Family().String(),
+		UserAgent: session.UserAgent,
+		IP:        session.IP,
+		AuthTime:  session.StartedAt().Unix(),
+	}
+	if session.IsImpersonated() {
+		response.Act = &dto.Actor{Sub: session.ActorID.String()}
+	}
+	if session.IsBound() {
+		response.Cnf = &dto.Confirmation{JKT: session.ProofKeyThumbprint, X5TS256: session.CertThumbprint}
+	}
+	return response
+}
+
+func newConfirmation(cnf *utils.Confirmation) *dto.Confirmation {
+	if cnf == nil {
+		return nil
+	}
+	return &dto.Confirmation{JKT: cnf.JKT, X5TS256: cnf.X5TS256}
+}
+
+func newActor(act *utils.Actor) *dto.Actor {
+	if act == nil {
+		return nil
+	}
+	return &dto.Actor{Sub: act.Sub, ClientID: act.ClientID, Act: newActor(act.Act)}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/model"
+	tokenFormat "medods_test_task/internal/tokenformat/impl"
+	"medods_test_task/internal/utils"
+)
+
+// memoryAccessTokens keeps reference access tokens in memory.
+type memoryAccessTokens struct {
+	mu     sync.Mutex
+	tokens map[string]model.AccessToken
+}
+
+func (r *memoryAccessTokens) Create(token *model.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (r *memoryAccessTokens) GetByHash(tokenHash string) (*model.AccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &token, nil
+}
+
+func (r *memoryAccessTokens) Delete(tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, tokenHash)
+	return nil
+}
+
+func (r *memoryAccessTokens) DeleteExpiredBefore(time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestIntrospectAndRevokeReferenceToken(t *testing.T) {
+	session := &model.RefreshToken{ID: uuid.New(), UserID: uuid.New(), ClientID: "backend", CreatedAt: time.Now()}
+	authService := &recordingAuthService{sessions: map[uuid.UUID]*model.RefreshToken{session.ID: session}}
+	format := tokenFormat.NewReferenceTokenFormat(&memoryAccessTokens{tokens: make(map[string]model.AccessToken)}, time.Hour)
+	router := newOAuthRouterWithFormat(authService, format)
+
+	reference, err := format.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+		UserID:         session.UserID,
+		RefreshTokenID: session.ID,
+		Scopes:         []string{"profile"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	introspect := func() dto.OAuthIntrospectionResponse {
+		t.Helper()
+		w := postFormAs(router, "/oauth/introspect", "backend", url.Values{"token": {reference}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("introspection status = %d: %s", w.Code, w.Body.String())
+		}
+		var response dto.OAuthIntrospectionResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := introspect()
+	if !response.Active || response.Sub != session.UserID.String() || response.ClientID != "backend" ||
+		response.Scope != "profile" || response.TokenType != TokenTypeHintAccessToken {
+		t.Errorf("introspection of an active reference = %+v", response)
+	}
+
+	if w := postFormAs(router, "/oauth/revoke", "backend", url.Values{"token": {reference}}); w.Code != http.StatusOK {
+		t.Fatalf("revocation status = %d: %s", w.Code, w.Body.String())
+	}
+	if len(authService.revoked) != 1 || authService.revoked[0] != session.ID {
+		t.Errorf("revoked %v, want session %s", authService.revoked, session.ID)
+	}
+
+	if response := introspect(); response.Active {
+		t.Error("a revoked reference is still active")
+	}
+}
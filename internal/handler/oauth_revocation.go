@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/middleware"
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/service/intf"
+)
+
+// Revoke godoc
+// @Summary      Отзыв токена
+// @Description  Завершает сессию, к которой относится access или refresh токен, по RFC 7009. Остальные сессии пользователя не затрагиваются. Конфиденциальный клиент из OAUTH_CLIENTS аутентифицируется (Basic или client_id/client_secret), и отозвать можно только токен, выданный этому клиенту, или токен без клиента. Access токен, полученный обменом токенов (RFC 8693), выдан клиенту из его act.client_id, и отозвать его может только этот клиент. Неизвестный или недействительный токен не считается ошибкой: ответ 200
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string  true   "Access или refresh токен"
+// @Param        token_type_hint  formData  string  false  "Подсказка о типе токена"  Enums(access_token, refresh_token)
+// @Param        client_id        formData  string  false  "Client ID"
+// @Param        client_secret    formData  string  false  "Client secret конфиденциального клиента"
+// @Success      200
+// @Failure      400  {object}  dto.OAuthErrorResponse
+// @Failure      401  {object}  dto.OAuthErrorResponse
+// @Failure      500  {object}  dto.OAuthErrorResponse
+// @Router       /oauth/revoke [post]
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var input dto.OAuthRevocationRequest
+	if err := c.ShouldBind(&input); err != nil {
+		h.abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+
+	clientID, _, oauthErr := requestClient(c)
+	if oauthErr != nil {
+		h.abortWithOAuthError(c, oauthErr)
+		return
+	}
+
+	// As with introspection, the hint only decides which lookup runs first.
+	lookups := []func(string) (*model.RefreshToken, string, bool){h.revokedAccessToken, h.revokedRefreshToken}
+	if input.TokenTypeHint == TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		session, owner, ok := lookup(input.Token)
+		if !ok {
+			continue
+		}
+		// RFC 7009 section 2.1: a client may only revoke its own tokens.
+		if owner != "" && owner != clientID {
+			h.abortWithOAuthError(c, newOAuthError(http.StatusBadRequest, "unauthorized_client", "token was issued to another client"))
+			return
+		}
+		err := h.authService.RevokeSessionByTokenID(session.ID)
+		if err != nil && !errors.Is(err, intf.ErrRefreshTokenNotFound) {
+			h.abortWithOAuthError(c, newOAuthError(http.StatusInternalServerError, "server_error", err.Error()))
+			return
+		}
+		break
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// revokedAccessToken returns the session of a correctly signed access token
+// and the client the token was issued to. Expired access tokens still
+// identify their session. A token obtained by token exchange belongs to the
+// client that exchanged it, named in act, rather than to the client of the
+// session, so only that client may revoke it.
+func (h *OAuthHandler) revokedAccessToken(token string) (*model.RefreshToken, string, bool) {
+	claims, err := middleware.ParseAccessTokenWithoutClaimsValidation(token, h.tokenFormat)
+	if err != nil {
+		return nil, "", false
+	}
+	session, err := h.authService.GetSession(claims.RefreshTokenID)
+	if err != nil {
+		return nil, "", false
+	}
+	if claims.Act != nil && claims.Act.ClientID != "" {
+		return session, claims.Act.ClientID, true
+	}
+	return session, session.ClientID, true
+}
+
+// revokedRefreshToken returns the refresh token with a matching secret and
+// the client it was issued to.
+func (h *OAuthHandler) revokedRefreshToken(token string) (*model.RefreshToken, string, bool) {
+	session, _, err := h.authService.InspectRefreshToken(token)
+	if err != nil {
+		return nil, "", false
+	}
+	return session, session.ClientID, true
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/service/intf"
+	"medods_test_task/internal/utils"
+)
+
+func (s *recordingAuthService) GetSession(refreshTokenID uuid.UUID) (*model.RefreshToken, error) {
+	if session, ok := s.sessions[refreshTokenID]; ok {
+		return session, nil
+	}
+	return nil, intf.ErrRefreshTokenNotFound
+}
+
+func (s *recordingAuthService) InspectRefreshToken(rawRefreshToken string) (*model.RefreshToken, bool, error) {
+	if session, ok := s.refreshTokens[rawRefreshToken]; ok {
+		return session, true, nil
+	}
+	return nil, false, errors.New("unknown refresh token")
+}
+
+func (s *recordingAuthService) RevokeSessionByTokenID(refreshTokenID uuid.UUID) error {
+	s.revoked = append(s.revoked, refreshTokenID)
+	return nil
+}
+
+func TestRevokeOwnership(t *testing.T) {
+	authService := &recordingAuthService{
+		sessions:      map[uuid.UUID]*model.RefreshToken{},
+		refreshTokens: map[string]*model.RefreshToken{},
+	}
+	router, format := newOAuthRouter(t, authService)
+
+	// accessToken issues an access token of a new session of sessionClient,
+	// exchanged by exchangedBy unless that is empty.
+	accessToken := func(sessionClient, exchangedBy string) (string, uuid.UUID) {
+		session := &model.RefreshToken{ID: uuid.New(), UserID: uuid.New(), ClientID: sessionClient}
+		authService.sessions[session.ID] = session
+		var act *utils.Actor
+		if exchangedBy != "" {
+			act = &utils.Actor{ClientID: exchangedBy}
+		}
+		token, err := format.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+			UserID:         session.UserID,
+			RefreshTokenID: session.ID,
+			Act:            act,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token, session.ID
+	}
+	refreshToken := func(sessionClient string) (string, uuid.UUID) {
+		session := &model.RefreshToken{ID: uuid.New(), UserID: uuid.New(), ClientID: sessionClient}
+		token := utils.FormatRefreshToken(session.ID, "secret")
+		authService.refreshTokens[token] = session
+		return token, session.ID
+	}
+
+	tests := []struct {
+		name    string
+		token   func() (string, uuid.UUID)
+		caller  string
+		revoked bool
+	}{
+		{"access token without client", func() (string, uuid.UUID) { return accessToken("", "") }, "", true},
+		{"access token of the caller", func() (string, uuid.UUID) { return accessToken("backend", "") }, "backend", true},
+		{"access token of another client", func() (string, uuid.UUID) { return accessToken("backend", "") }, "reports", false},
+		{"access token of a client, anonymously", func() (string, uuid.UUID) { return accessToken("backend", "") }, "", false},
+		{"exchanged token, by the exchanging client", func() (string, uuid.UUID) { return accessToken("", "backend") }, "backend", true},
+		{"exchanged token, anonymously", func() (string, uuid.UUID) { return accessToken("", "backend") }, "", false},
+		{"exchanged token, by the session client", func() (string, uuid.UUID) { return accessToken("backend", "reports") }, "backend", false},
+		{"exchanged token of a client session, by the exchanging client", func() (string, uuid.UUID) { return accessToken("backend", "reports") }, "reports", true},
+		{"refresh token of the caller", func() (string, uuid.UUID) { return refreshToken("backend") }, "backend", true},
+		{"refresh token of another client", func() (string, uuid.UUID) { return refreshToken("backend") }, "reports", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService.revoked = nil
+			token, sessionID := tt.token()
+
+			w := postFormAs(router, "/oauth/revoke", tt.caller, url.Values{"token": {token}})
+			if tt.revoked {
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+				}
+				if len(authService.revoked) != 1 || authService.revoked[0] != sessionID {
+					t.Errorf("revoked %v, want session %s", authService.revoked, sessionID)
+				}
+				return
+			}
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"unauthorized_client"`) {
+				t.Errorf("status = %d, body = %s; want 400 unauthorized_client", w.Code, w.Body.String())
+			}
+			if len(authService.revoked) != 0 {
+				t.Errorf("revoked %v, want nothing", authService.revoked)
+			}
+		})
+	}
+
+	t.Run("unknown token", func(t *testing.T) {
+		authService.revoked = nil
+		w := postFormAs(router, "/oauth/revoke", "", url.Values{"token": {"unknown"}})
+		if w.Code != http.StatusOK || len(authService.revoked) != 0 {
+			t.Errorf("status = %d, revoked %v; want 200 and nothing revoked", w.Code, authService.revoked)
+		}
+	})
+}
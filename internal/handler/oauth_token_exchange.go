@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/middleware"
+	"medods_test_task/internal/service/intf"
+	"medods_test_task/internal/utils"
+)
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// TokenTypeUserID is a subject_token that is just a user ID. It names the
+	// user to impersonate when the support user, who holds no token of that
+	// user, acts through actor_token.
+	TokenTypeUserID = "urn:medods:params:oauth:token-type:user_id"
+)
+
+// tokenExchangeGrant implements RFC 8693 for an authenticated client. With
+// actor_token the holder of that access token impersonates the subject and
+// gets a new session of the subject. Without it the subject token, an access
+// token, is exchanged for a narrower access token of the same session. The
+// tokens are bound to the calling client's DPoP key or certificate, if it
+// presents one, and a sender-constrained token presented here needs the same
+// proof of possession as at a resource.
+func (h *OAuthHandler) tokenExchangeGrant(c *gin.Context, input *dto.OAuthTokenRequest) (*dto.OAuthTokenResponse, *oauthError) {
+	clientID, ok := middleware.AuthenticateClient(c)
+	if !ok {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	if input.SubjectToken == "" || input.SubjectTokenType == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "subject_token and subject_token_type are required")
+	}
+	if input.RequestedTokenType != "" && input.RequestedTokenType != TokenTypeAccessToken {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "requested_token_type "+input.RequestedTokenType+" is not supported")
+	}
+	if input.Audience != "" && input.Audience != config.Load().JWTAudience {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_target", "audience "+input.Audience+" is not served")
+	}
+
+	binding, proof, err := middleware.RequestProof(c, h.dpopVerifier)
+	if err != nil {
+		return nil, newDPoPOAuthError(err)
+	}
+
+	var tokens *intf.Tokens
+	var oauthErr *oauthError
+	switch {
+	case input.ActorToken != "":
+		tokens, oauthErr = h.impersonationExchange(c, input, clientID, binding, proof)
+	case input.RequestedSubject != "":
+		tokens, oauthErr = h.requestedSubjectExchange(c, input, clientID, binding, proof)
+	default:
+		tokens, oauthErr = h.delegationExchange(c, input, clientID, binding, proof)
+	}
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	response := newOAuthTokenResponse(tokens)
+	response.IssuedTokenType = TokenTypeAccessToken
+	return response, nil
+}
+
+// delegationExchange swaps the subject token for a narrower access token of
+// the same session.
+func (h *OAuthHandler) delegationExchange(c *gin.Context, input *dto.OAuthTokenRequest, clientID string, binding intf.Binding, proof *dpop.Proof) (*intf.Tokens, *oauthError) {
+	claims, _, oauthErr := h.exchangedAccessToken(c, proof, "subject_token", input.SubjectToken, input.SubjectTokenType, true)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	tokens, err := h.authService.ExchangeToken(intf.ExchangeRequest{
+		RefreshTokenID: claims.RefreshTokenID,
+		SubjectScopes:  claims.Scopes(),
+		SubjectAct:     claims.Act,
+		Scopes:         utils.ParseScope(input.Scope),
+		ClientID:       clientID,
+		Binding:        binding,
+	})
+	if err != nil {
+		return nil, oauthErrorFromService(err)
+	}
+	return tokens, nil
+}
+
+// impersonationExchange is impersonation in the shape of RFC 8693: the
+// support user's access token is the actor_token and the user to act as is
+// the subject, given by ID or by one of their access tokens. The DPoP proof
+// has room for the hash of one token, so it must cover the actor token; a
+// DPoP-bound subject token only has to be bound to the same key.
+func (h *OAuthHandler) impersonationExchange(c *gin.Context, input *dto.OAuthTokenRequest, clientID string, binding intf.Binding, proof *dpop.Proof) (*intf.Tokens, *oauthError) {
+	if input.ActorTokenType == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "actor_token_type is required with actor_token")
+	}
+	actorClaims, actorID, oauthErr := h.exchangedAccessToken(c, proof, "actor_token", input.ActorToken, input.ActorTokenType, true)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+	if oauthErr := rejectDelegatedToken("actor_token", actorClaims); oauthErr != nil {
+		return nil, oauthErr
+	}
+
+	var subjectID uuid.UUID
+	switch input.SubjectTokenType {
+	case TokenTypeUserID:
+		var err error
+		if subjectID, err = uuid.Parse(input.SubjectToken); err != nil {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "subject_token must be a user ID")
+		}
+	default:
+		var subjectClaims *utils.AccessTokenClaims
+		if subjectClaims, subjectID, oauthErr = h.exchangedAccessToken(c, proof, "subject_token", input.SubjectToken, input.SubjectTokenType, false); oauthErr != nil {
+			return nil, oauthErr
+		}
+		if oauthErr := rejectDelegatedToken("subject_token", subjectClaims); oauthErr != nil {
+			return nil, oauthErr
+		}
+	}
+
+	return h.impersonate(c, actorClaims, actorID, subjectID, input, clientID, binding)
+}
+
+// requestedSubjectExchange is the earlier form of impersonation, kept for
+// existing callers: the support user's token is the subject_token and the
+// user to act as is the non-standard requested_subject parameter.
+func (h *OAuthHandler) requestedSubjectExchange(c *gin.Context, input *dto.OAuthTokenRequest, clientID string, binding intf.Binding, proof *dpop.Proof) (*intf.Tokens, *oauthError) {
+	actorClaims, actorID, oauthErr := h.exchangedAccessToken(c, proof, "subject_token", input.SubjectToken, input.SubjectTokenType, true)
+	if oauthErr != nil {
+		return nil, oauthErr
+	}
+	if oauthErr := rejectDelegatedToken("subject_token", actorClaims); oauthErr != nil {
+		return nil, oauthErr
+	}
+	subjectID, err := uuid.Parse(input.RequestedSubject)
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "requested_subject must be a user ID")
+	}
+
+	return h.impersonate(c, actorClaims, actorID, subjectID, input, clientID, binding)
+}
+
+func (h *OAuthHandler) impersonate(c *gin.Context, actorClaims *utils.AccessTokenClaims, actorID, subjectID uuid.UUID, input *dto.OAuthTokenRequest, clientID string, binding intf.Binding) (*intf.Tokens, *oauthError) {
+	tokens, err := h.authService.Impersonate(intf.ImpersonationRequest{
+		ActorID:        actorID,
+		ActorSessionID: actorClaims.RefreshTokenID,
+		ActorScopes:    actorClaims.Scopes(),
+		SubjectID:      subjectID,
+		UserAgent:      c.Request.UserAgent(),
+		IP:             c.ClientIP(),
+		ClientID:       clientID,
+		Scopes:         utils.ParseScope(input.Scope),
+		Binding:        binding,
+	})
+	if errors.Is(err, intf.ErrImpersonationForbidden) {
+		return nil, newOAuthError(http.StatusForbidden, "access_denied", err.Error())
+	}
+	if err != nil {
+		return nil, oauthErrorFromService(err)
+	}
+	return tokens, nil
+}
+
+// rejectDelegatedToken refuses a token with an act claim where impersonation
+// needs a token the user holds directly. A token obtained by exchange or
+// within an impersonated session acts for someone else, and starting an
+// impersonation from it would hide who is really acting.
+func rejectDelegatedToken(param string, claims *utils.AccessTokenClaims) *oauthError {
+	if claims.Act != nil {
+		return newOAuthError(http.StatusBadRequest, "invalid_grant", param+" was issued to an actor and cannot be used for impersonation")
+	}
+	return nil
+}
+
+// exchangedAccessToken verifies an access token passed as the named
+// parameter, including its sender constraint, and returns its claims and
+// user. requireAth is passed to middleware.CheckPresentedTokenBinding.
+func (h *OAuthHandler) exchangedAccessToken(c *gin.Context, proof *dpop.Proof, param, token, tokenType string, requireAth bool) (*utils.AccessTokenClaims, uuid.UUID, *oauthError) {
+	if tokenType != TokenTypeAccessToken {
+		return nil, uuid.Nil, newOAuthError(http.StatusBadRequest, "invalid_request", param+"_type "+tokenType+" is not supported")
+	}
+	claims, err := middleware.ParseAccessToken(token, h.tokenFormat)
+	if err != nil {
+		return nil, uuid.Nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid "+param+": "+err.Error())
+	}
+	if err := middleware.CheckPresentedTokenBinding(c, proof, token, claims, requireAth); err != nil {
+		return nil, uuid.Nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid "+param+": "+err.Error())
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, uuid.Nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid "+param+": sub must be a user ID")
+	}
+	return claims, userID, nil
+}
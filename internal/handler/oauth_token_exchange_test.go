@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/service/intf"
+	"medods_test_task/internal/signing"
+	tokenFormat "medods_test_task/internal/tokenformat/impl"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+// recordingAuthService grants every exchange and impersonation and records
+// the requests it got.
+type recordingAuthService struct {
+	intf.AuthService
+	exchanges      []intf.ExchangeRequest
+	impersonations []intf.ImpersonationRequest
+	// sessions are found by GetSession, refreshTokens by
+	// InspectRefreshToken, and revoked lists the sessions revoked.
+	sessions      map[uuid.UUID]*model.RefreshToken
+	refreshTokens map[string]*model.RefreshToken
+	revoked       []uuid.UUID
+}
+
+func (s *recordingAuthService) ExchangeToken(request intf.ExchangeRequest) (*intf.Tokens, error) {
+	s.exchanges = append(s.exchanges, request)
+	return &intf.Tokens{AccessToken: "exchanged"}, nil
+}
+
+func (s *recordingAuthService) Impersonate(request intf.ImpersonationRequest) (*intf.Tokens, error) {
+	s.impersonations = append(s.impersonations, request)
+	return &intf.Tokens{AccessToken: "impersonated", RefreshToken: "refresh"}, nil
+}
+
+func newTestTokenFormat(t *testing.T) tokenFormatIntf.TokenFormat {
+	t.Helper()
+	key, err := signing.NewSymmetricKey([]byte("test-secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenFormat.NewJWTTokenFormat(signing.NewStaticKeyring(key))
+}
+
+func newOAuthRouter(t *testing.T, authService intf.AuthService) (*gin.Engine, tokenFormatIntf.TokenFormat) {
+	t.Helper()
+	format := newTestTokenFormat(t)
+	return newOAuthRouterWithFormat(authService, format), format
+}
+
+func newOAuthRouterWithFormat(authService intf.AuthService, format tokenFormatIntf.TokenFormat) *gin.Engine {
+	h := NewOAuthHandler(authService, nil, format, dpop.NewVerifier(time.Minute, 0, 0, nil))
+	router := gin.New()
+	h.RegisterOAuthHandlers(router.Group("/"))
+	return router
+}
+
+func issueHandlerTestToken(t *testing.T, format tokenFormatIntf.TokenFormat, userID uuid.UUID, act *utils.Actor) string {
+	t.Helper()
+	token, err := format.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+		UserID:         userID,
+		RefreshTokenID: uuid.New(),
+		Scopes:         []string{"profile"},
+		Act:            act,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func postForm(router *gin.Engine, path string, form url.Values) *httptest.ResponseRecorder {
+	return postFormAs(router, path, "backend", form)
+}
+
+// postFormAs posts form authenticated as the confidential client clientID,
+// whose secret is clientID+"-secret", or anonymously if clientID is empty.
+func postFormAs(router *gin.Engine, path, clientID string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com"+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, clientID+"-secret")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTokenExchangeRejectsDelegatedTokensForImpersonation(t *testing.T) {
+	authService := &recordingAuthService{}
+	router, format := newOAuthRouter(t, authService)
+
+	actorID, subjectID := uuid.New(), uuid.New()
+	actorToken := issueHandlerTestToken(t, format, actorID, nil)
+	delegatedActorToken := issueHandlerTestToken(t, format, actorID, &utils.Actor{ClientID: "backend"})
+	subjectToken := issueHandlerTestToken(t, format, subjectID, nil)
+	impersonatedSubjectToken := issueHandlerTestToken(t, format, subjectID, &utils.Actor{Sub: uuid.NewString()})
+
+	exchange := func(subject, subjectType, actor string) url.Values {
+		form := url.Values{
+			"grant_type":         {GrantTypeTokenExchange},
+			"subject_token":      {subject},
+			"subject_token_type": {subjectType},
+		}
+		if actor != "" {
+			form.Set("actor_token", actor)
+			form.Set("actor_token_type", TokenTypeAccessToken)
+		}
+		return form
+	}
+	legacy := exchange(delegatedActorToken, TokenTypeAccessToken, "")
+	legacy.Set("requested_subject", subjectID.String())
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{"plain actor and subject IDs", exchange(subjectID.String(), TokenTypeUserID, actorToken), http.StatusOK},
+		{"plain actor and subject tokens", exchange(subjectToken, TokenTypeAccessToken, actorToken), http.StatusOK},
+		{"delegated actor token", exchange(subjectID.String(), TokenTypeUserID, delegatedActorToken), http.StatusBadRequest},
+		{"impersonation subject token", exchange(impersonatedSubjectToken, TokenTypeAccessToken, actorToken), http.StatusBadRequest},
+		{"delegated token with requested_subject", legacy, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService.impersonations = nil
+			w := postForm(router, "/oauth/token", tt.form)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if impersonated := len(authService.impersonations) != 0; impersonated != (tt.status == http.StatusOK) {
+				t.Errorf("impersonation reached the service: %v", impersonated)
+			}
+			if tt.status != http.StatusOK && !strings.Contains(w.Body.String(), `"invalid_grant"`) {
+				t.Errorf("body = %s, want invalid_grant", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokenExchangePassesSubjectActorChain(t *testing.T) {
+	authService := &recordingAuthService{}
+	router, format := newOAuthRouter(t, authService)
+
+	act := &utils.Actor{ClientID: "reports", Act: &utils.Actor{Sub: uuid.NewString()}}
+	w := postForm(router, "/oauth/token", url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {issueHandlerTestToken(t, format, uuid.New(), act)},
+		"subject_token_type": {TokenTypeAccessToken},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if len(authService.exchanges) != 1 {
+		t.Fatalf("%d exchanges reached the service, want 1", len(authService.exchanges))
+	}
+	got := authService.exchanges[0]
+	if got.ClientID != "backend" || got.SubjectAct == nil || got.SubjectAct.ClientID != "reports" ||
+		got.SubjectAct.Act == nil || got.SubjectAct.Act.Sub != act.Act.Sub {
+		t.Errorf("exchange request = %+v, want the act chain of the subject token from client backend", got)
+	}
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/signing"
+)
+
+type OIDCHandler struct {
+	keyring *signing.Keyring
+}
+
+func NewOIDCHandler(keyring *signing.Keyring) *OIDCHandler {
+	return &OIDCHandler{keyring: keyring}
+}
+
+func (h *OIDCHandler) RegisterOIDCHandlers(router gin.IRoutes) {
+	router.GET("/.well-known/openid-configuration", h.GetConfiguration)
+}
+
+// GetConfiguration serves the OpenID Provider metadata. Like the JWKS it
+// lives outside /api and the swagger spec. There is no authorization
+// endpoint, so no response types are advertised: id_tokens come only from
+// the token endpoint grants. Under HS512 the provider is disabled, since
+// clients cannot verify id_tokens signed with the server secret.
+func (h *OIDCHandler) GetConfiguration(c *gin.Context) {
+	key := h.keyring.Active()
+	if key.IsSymmetric() {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Error: "OpenID Connect requires an asymmetric JWT_ALGORITHM",
+		})
+		return
+	}
+
+	cfg := config.Load()
+	issuer := cfg.Issuer
+	scopes := cfg.SupportedScopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, dto.OpenIDConfigurationResponse{
+		Issuer:                            issuer,
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		TokenEndpoint:                     issuer + "/api/oauth/token",
+		UserInfoEndpoint:                  issuer + "/api/userinfo",
+		RevocationEndpoint:                issuer + "/api/oauth/revoke",
+		IntrospectionEndpoint:             issuer + "/api/oauth/introspect",
+		ResponseTypesSupported:            []string{},
+		GrantTypesSupported:               []string{GrantTypeRefreshToken, GrantTypePassword, GrantTypeTokenExchange},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{key.Method.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+		ScopesSupported:                   scopes,
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "sid"},
+		DPoPSigningAlgValuesSupported:     dpop.SupportedAlgorithms(),
+		TLSClientCertificateBoundTokens:   cfg.TLSCertFile != "",
+	})
+}
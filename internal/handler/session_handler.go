@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/middleware"
+	"medods_test_task/internal/service/intf"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
+)
+
+type SessionHandler struct {
+	authService  intf.AuthService
+	tokenFormat  tokenFormatIntf.TokenFormat
+	dpopVerifier *dpop.Verifier
+}
+
+func NewSessionHandler(authService intf.AuthService, tokenFormat tokenFormatIntf.TokenFormat, dpopVerifier *dpop.Verifier) *SessionHandler {
+	return &SessionHandler{
+		authService:  authService,
+		tokenFormat:  tokenFormat,
+		dpopVerifier: dpopVerifier,
+	}
+}
+
+func (h *SessionHandler) RegisterSessionHandlers(router *gin.RouterGroup) {
+	sessionGroup := router.Group("/auth/sessions")
+	sessionGroup.Use(middleware.AuthMiddleware(h.authService, h.tokenFormat, h.dpopVerifier))
+	{
+		sessionGroup.GET("", h.ListSessions)
+		sessionGroup.DELETE("/:id", middleware.RequireCSRF(), h.RevokeSession)
+		sessionGroup.POST("/revoke-others", middleware.RequireCSRF(), h.RevokeOtherSessions)
+	}
+}
+
+// ListSessions godoc
+// @Summary      Список активных сессий
+// @Description  Возвращает активные сессии пользователя. ID сессии не меняется при обновлении токенов, last_used_at - время последнего обновления
+// @Tags         sessions
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  dto.SessionsResponse
+// @Failure      401  {object}  dto.ErrorResponse
+// @Failure      500  {object}  dto.ErrorResponse
+// @Router       /auth/sessions [get]
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	refreshTokenID, err := getRefreshTokenIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(refreshTokenID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	response := dto.SessionsResponse{Sessions: make([]dto.SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, dto.SessionResponse{
+			ID:             session.Family(),
+			Current:        session.ID == refreshTokenID,
+			UserAgent:      session.UserAgent,
+			IP:             session.IP,
+			Scope:          session.Scope,
+			ImpersonatedBy: session.ActorID,
+			CreatedAt:      session.StartedAt(),
+			LastUsedAt:     session.CreatedAt,
+			ExpiresAt:      session.ExpiresAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession godoc
+// @Summary      Завершение сессии
+// @Description  Деактивирует одну сессию пользователя по её ID
+// @Tags         sessions
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id            path    string  true   "Session ID (UUID)"
+// @Param        X-CSRF-Token  header  string  false  "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)"
+// @Success      200  {object}  dto.MessageResponse
+// @Failure      400  {object}  dto.ErrorResponse
+// @Failure      401  {object}  dto.ErrorResponse
+// @Failure      403  {object}  dto.ErrorResponse
+// @Failure      404  {object}  dto.ErrorResponse
+// @Failure      500  {object}  dto.ErrorResponse
+// @Router       /auth/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: "invalid session id format (must be UUID)",
+		})
+		return
+	}
+
+	refreshTokenID, err := getRefreshTokenIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.RevokeSession(refreshTokenID, sessionID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, intf.ErrSessionNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, newErrorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{
+		Message: "session revoked",
+	})
+}
+
+// RevokeOtherSessions godoc
+// @Summary      Завершение остальных сессий
+// @Description  Деактивирует все сессии пользователя, кроме текущей
+// @Tags         sessions
+// @Security     BearerAuth
+// @Produce      json
+// @Param        X-CSRF-Token  header  string  false  "Значение cookie csrf_token (при TOKEN_TRANSPORT=cookie)"
+// @Success      200  {object}  dto.MessageResponse
+// @Failure      401  {object}  dto.ErrorResponse
+// @Failure      403  {object}  dto.ErrorResponse
+// @Failure      500  {object}  dto.ErrorResponse
+// @Router       /auth/sessions/revoke-others [post]
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	refreshTokenID, err := getRefreshTokenIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.RevokeOtherSessions(refreshTokenID); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{
+		Message: "other sessions revoked",
+	})
+}
@@ -1,78 +1,86 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
-	"medods_test_task/internal/config"
+	"medods_test_task/internal/dpop"
 	"medods_test_task/internal/dto"
 	service "medods_test_task/internal/service/intf"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
 )
 
-type AccessTokenClaims struct {
-	RefreshTokenID uuid.UUID `json:"refresh_token_id"`
-	jwt.RegisteredClaims
-}
+// Authorization schemes accepted for access tokens, lower-cased.
+const (
+	schemeBearer = "bearer"
+	schemeDPoP   = "dpop"
+)
 
-func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
+func AuthMiddleware(authService service.AuthService, tokenFormat tokenFormatIntf.TokenFormat, dpopVerifier *dpop.Verifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error: "authorization header is missing",
-			})
+		claims, scheme, token, ok := parseAccessToken(c, tokenFormat, true)
+		if !ok {
 			return
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error: "authorization header format must be Bearer {token}",
-			})
+		if !checkTokenBinding(c, dpopVerifier, scheme, token, claims) {
 			return
 		}
 
-		tokenStr := parts[1]
-
-		token, err := jwt.ParseWithClaims(tokenStr, &AccessTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if token.Method.Alg() != "HS512" {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return config.Load().JWTSecret, nil
-		})
-
+		userID, err := uuid.Parse(claims.Subject)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error: err.Error(),
+				Error: "invalid token claims: sub must be a user ID",
 			})
 			return
 		}
 
-		claims, ok := token.Claims.(*AccessTokenClaims)
-		if !ok || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error: "invalid token claims",
+		isActive, err := authService.IsTokenValid(claims.RefreshTokenID)
+		if err != nil {
+			// The session or the user directory could not be checked, which
+			// says nothing about the token, so the client should not drop it.
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, dto.ErrorResponse{
+				Error: "failed to check session",
 			})
 			return
 		}
-
-		if claims.RefreshTokenID == uuid.Nil {
+		if !isActive {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error: "invalid token claims: empty refresh_token_id",
+				Error: "token is no longer valid",
 			})
 			return
 		}
 
-		isActive, err := authService.IsTokenValid(claims.RefreshTokenID)
-		if err != nil || !isActive {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error: "token is no longer valid",
-			})
+		c.Set("refreshTokenID", claims.RefreshTokenID)
+		c.Set("authScheme", scheme)
+		c.Set("userID", userID)
+		c.Set("scopes", claims.Scopes())
+		c.Set("roles", claims.Roles)
+
+		c.Next()
+	}
+}
+
+// RefreshAuthMiddleware guards the refresh route. Unlike AuthMiddleware it
+// lets through tokens of sessions that are no longer active, so the service
+// can recognise a replayed refresh token and revoke its family. The access
+// token only identifies the session here, so an expired one is accepted as
+// long as its signature is valid, and it may be omitted entirely when the
+// refresh token carries its own ID.
+func RefreshAuthMiddleware(tokenFormat tokenFormatIntf.TokenFormat) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" && accessTokenCookie(c) == "" {
+			c.Next()
+			return
+		}
+
+		claims, _, _, ok := parseAccessToken(c, tokenFormat, false)
+		if !ok {
 			return
 		}
 
@@ -81,3 +89,74 @@ func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// parseAccessToken reads the access token from the request and returns its
+// claims together with the lower-cased scheme and the raw token.
+func parseAccessToken(c *gin.Context, tokenFormat tokenFormatIntf.TokenFormat, validateClaims bool) (*utils.AccessTokenClaims, string, string, bool) {
+	scheme, token, ok := readAccessToken(c)
+	if !ok {
+		return nil, "", "", false
+	}
+
+	claims, err := parseTokenClaims(token, tokenFormat, validateClaims)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: err.Error(),
+		})
+		return nil, "", "", false
+	}
+
+	return claims, scheme, token, true
+}
+
+// readAccessToken takes the access token from the Authorization header or,
+// in the cookie transport, from the access token cookie. A cookie token is
+// always a bearer token.
+func readAccessToken(c *gin.Context) (string, string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		if token := accessTokenCookie(c); token != "" {
+			return schemeBearer, token, true
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "authorization header is missing",
+		})
+		return "", "", false
+	}
+
+	parts := strings.SplitN(authHeader, " ", 2)
+	scheme := strings.ToLower(parts[0])
+	if len(parts) != 2 || (scheme != schemeBearer && scheme != schemeDPoP) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
+			Error: "authorization header format must be Bearer {token} or DPoP {token}",
+		})
+		return "", "", false
+	}
+
+	return scheme, parts[1], true
+}
+
+// ParseAccessToken verifies an access token in the configured format and
+// returns its claims, including expiry, issuer and audience.
+func ParseAccessToken(tokenStr string, tokenFormat tokenFormatIntf.TokenFormat) (*utils.AccessTokenClaims, error) {
+	return parseTokenClaims(tokenStr, tokenFormat, true)
+}
+
+// ParseAccessTokenWithoutClaimsValidation verifies only the signature of an
+// access token, so expired tokens are accepted too.
+func ParseAccessTokenWithoutClaimsValidation(tokenStr string, tokenFormat tokenFormatIntf.TokenFormat) (*utils.AccessTokenClaims, error) {
+	return parseTokenClaims(tokenStr, tokenFormat, false)
+}
+
+func parseTokenClaims(tokenStr string, tokenFormat tokenFormatIntf.TokenFormat, validateClaims bool) (*utils.AccessTokenClaims, error) {
+	claims, err := tokenFormat.Parse(tokenStr, validateClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.RefreshTokenID == uuid.Nil {
+		return nil, errors.New("invalid token claims: empty refresh_token_id")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	service "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/utils"
+)
+
+// RequestBinding verifies the DPoP proof of a token request, if it carries
+// one, and returns what the tokens issued for it are to be bound to.
+func RequestBinding(c *gin.Context, verifier *dpop.Verifier) (service.Binding, error) {
+	binding, _, err := RequestProof(c, verifier)
+	return binding, err
+}
+
+// RequestProof is RequestBinding that also returns the verified proof, nil
+// when the request carries none, for checking tokens presented in the body.
+func RequestProof(c *gin.Context, verifier *dpop.Verifier) (service.Binding, *dpop.Proof, error) {
+	binding := service.Binding{X5T: utils.CertificateThumbprint(c.Request)}
+	if c.GetHeader(dpop.HeaderProof) == "" {
+		return binding, nil, nil
+	}
+
+	setDPoPNonce(c, verifier)
+	proof, err := verifier.VerifyRequest(c.Request, "")
+	if err != nil {
+		return service.Binding{}, nil, err
+	}
+	binding.JKT = proof.JKT
+	return binding, proof, nil
+}
+
+// CheckPresentedTokenBinding enforces the cnf claim of an access token sent
+// in a request body rather than in Authorization, as in token exchange. A
+// DPoP-bound token needs the request's proof signed with its key; with
+// requireAth the proof must also carry the hash of the token. A
+// certificate-bound token needs the same TLS client certificate.
+func CheckPresentedTokenBinding(c *gin.Context, proof *dpop.Proof, token string, claims *utils.AccessTokenClaims, requireAth bool) error {
+	if claims.Cnf == nil {
+		return nil
+	}
+	cnf := *claims.Cnf
+
+	if cnf.JKT != "" {
+		switch {
+		case proof == nil:
+			return errors.New("token is DPoP-bound and the request carries no DPoP proof")
+		case proof.JKT != cnf.JKT:
+			return errors.New("DPoP proof is signed with another key")
+		case requireAth && !proof.CoversAccessToken(token):
+			return errors.New("ath of the DPoP proof does not match the token")
+		}
+	}
+	if cnf.X5TS256 != "" && cnf.X5TS256 != utils.CertificateThumbprint(c.Request) {
+		return errors.New("token is bound to another client certificate")
+	}
+	return nil
+}
+
+// checkTokenBinding enforces the cnf claim of a sender-constrained access
+// token: a DPoP-bound token needs the DPoP scheme and a proof signed with
+// its key, a certificate-bound one needs the same TLS client certificate.
+func checkTokenBinding(c *gin.Context, verifier *dpop.Verifier, scheme, token string, claims *utils.AccessTokenClaims) bool {
+	var cnf utils.Confirmation
+	if claims.Cnf != nil {
+		cnf = *claims.Cnf
+	}
+
+	if scheme == schemeDPoP {
+		setDPoPNonce(c, verifier)
+	}
+	switch {
+	case cnf.JKT != "" && scheme != schemeDPoP:
+		abortWithTokenError(c, "Bearer", "invalid_token", "DPoP-bound token must be sent with the DPoP scheme")
+		return false
+	case cnf.JKT == "" && scheme == schemeDPoP:
+		abortWithTokenError(c, "DPoP", "invalid_token", "token is not DPoP-bound")
+		return false
+	case cnf.JKT != "":
+		proof, err := verifier.VerifyRequest(c.Request, token)
+		if err != nil {
+			abortWithTokenError(c, "DPoP", dpop.ErrorCode(err), err.Error())
+			return false
+		}
+		if proof.JKT != cnf.JKT {
+			abortWithTokenError(c, "DPoP", "invalid_dpop_proof", "DPoP proof is signed with another key")
+			return false
+		}
+	}
+
+	if cnf.X5TS256 != "" && cnf.X5TS256 != utils.CertificateThumbprint(c.Request) {
+		challenge := "Bearer"
+		if scheme == schemeDPoP {
+			challenge = "DPoP"
+		}
+		abortWithTokenError(c, challenge, "invalid_token", "token is bound to another client certificate")
+		return false
+	}
+	return true
+}
+
+func setDPoPNonce(c *gin.Context, verifier *dpop.Verifier) {
+	if nonce := verifier.Nonce(); nonce != "" {
+		c.Header(dpop.HeaderNonce, nonce)
+	}
+}
+
+func abortWithTokenError(c *gin.Context, scheme, code, description string) {
+	challenge := fmt.Sprintf(`%s error="%s", error_description="%s"`, scheme, code, description)
+	if scheme == "DPoP" {
+		challenge += fmt.Sprintf(`, algs="%s"`, strings.Join(dpop.SupportedAlgorithms(), " "))
+	}
+	c.Header("WWW-Authenticate", challenge)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{
+		Error: description,
+		Code:  code,
+	})
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/signing"
+	"medods_test_task/internal/utils"
+)
+
+const tokenURL = "http://example.com/token"
+
+type proofKey struct {
+	privateKey *ecdsa.PrivateKey
+	jwk        dto.JWK
+	jkt        string
+}
+
+func newProofKey(t *testing.T) proofKey {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := signing.PublicKeyToJWK(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := signing.Thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proofKey{privateKey: privateKey, jwk: jwk, jkt: jkt}
+}
+
+func TestCheckPresentedTokenBinding(t *testing.T) {
+	_, format := newScopedRouter(t)
+	key := newProofKey(t)
+	otherKey := newProofKey(t)
+
+	bound := issueTestToken(t, format, nil, &utils.Confirmation{JKT: key.jkt})
+	unbound := issueTestToken(t, format, nil, nil)
+
+	tests := []struct {
+		name       string
+		token      string
+		signer     *proofKey
+		proofFor   string
+		requireAth bool
+		ok         bool
+	}{
+		{"unbound without proof", unbound, nil, "", true, true},
+		{"bound without proof", bound, nil, "", true, false},
+		{"bound with matching proof", bound, &key, bound, true, true},
+		{"proof for another token", bound, &key, unbound, true, false},
+		{"proof for another token without ath", bound, &key, unbound, false, true},
+		{"proof signed with another key", bound, &otherKey, bound, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := dpop.NewVerifier(time.Minute, 0, 0, nil)
+			var checkErr error
+			router := gin.New()
+			router.POST("/token", func(c *gin.Context) {
+				_, proof, err := RequestProof(c, verifier)
+				if err != nil {
+					t.Fatalf("RequestProof: %v", err)
+				}
+				claims, err := ParseAccessToken(tt.token, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkErr = CheckPresentedTokenBinding(c, proof, tt.token, claims, tt.requireAth)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tokenURL, nil)
+			if tt.signer != nil {
+				req.Header.Set(dpop.HeaderProof, signTestProof(t, tt.signer.privateKey, tt.signer.jwk, http.MethodPost, tokenURL, tt.proofFor))
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if ok := checkErr == nil; ok != tt.ok {
+				t.Errorf("CheckPresentedTokenBinding = %v, want ok = %v", checkErr, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareEnforcesTokenBinding(t *testing.T) {
+	_, format := newScopedRouter(t)
+	verifier := dpop.NewVerifier(time.Minute, 0, 0, nil)
+	router := gin.New()
+	router.GET("/protected", AuthMiddleware(activeSessions{}, format, verifier), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	key := newProofKey(t)
+	otherKey := newProofKey(t)
+	certificate := &x509.Certificate{Raw: []byte("client certificate")}
+	otherCertificate := &x509.Certificate{Raw: []byte("other client certificate")}
+	thumbprint := sha256.Sum256(certificate.Raw)
+	x5t := base64.RawURLEncoding.EncodeToString(thumbprint[:])
+
+	dpopBound := issueTestToken(t, format, nil, &utils.Confirmation{JKT: key.jkt})
+	certBound := issueTestToken(t, format, nil, &utils.Confirmation{X5TS256: x5t})
+
+	tests := []struct {
+		name        string
+		scheme      string
+		token       string
+		signer      *proofKey
+		certificate *x509.Certificate
+		status      int
+	}{
+		{"DPoP-bound with its key", "DPoP", dpopBound, &key, nil, http.StatusOK},
+		{"DPoP-bound with another key", "DPoP", dpopBound, &otherKey, nil, http.StatusUnauthorized},
+		{"DPoP-bound without proof", "DPoP", dpopBound, nil, nil, http.StatusUnauthorized},
+		{"DPoP-bound as bearer", "Bearer", dpopBound, nil, nil, http.StatusUnauthorized},
+		{"certificate-bound with its certificate", "Bearer", certBound, nil, certificate, http.StatusOK},
+		{"certificate-bound with another certificate", "Bearer", certBound, nil, otherCertificate, http.StatusUnauthorized},
+		{"certificate-bound without certificate", "Bearer", certBound, nil, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, protectedURL, nil)
+			req.Header.Set("Authorization", tt.scheme+" "+tt.token)
+			if tt.signer != nil {
+				req.Header.Set(dpop.HeaderProof, signTestProof(t, tt.signer.privateKey, tt.signer.jwk, http.MethodGet, protectedURL, tt.token))
+			}
+			if tt.certificate != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.certificate}}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/dto"
+)
+
+// ClientAuthMiddleware authenticates an OAuth client with HTTP Basic or with
+// client_id and client_secret form fields (RFC 6749 section 2.3.1) against
+// OAUTH_CLIENTS.
+func ClientAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, ok := AuthenticateClient(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.OAuthErrorResponse{
+				Error:            "invalid_client",
+				ErrorDescription: "client authentication failed",
+			})
+			return
+		}
+
+		c.Set("clientID", clientID)
+
+		c.Next()
+	}
+}
+
+// AuthenticateClient checks the client credentials of the request and
+// returns the client ID. On failure it sets the WWW-Authenticate header the
+// invalid_client error must be sent with.
+func AuthenticateClient(c *gin.Context) (string, bool) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+
+	if !isValidClient(clientID, clientSecret) {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		return "", false
+	}
+	return clientID, true
+}
+
+func isValidClient(clientID, clientSecret string) bool {
+	if clientID == "" {
+		return false
+	}
+	expected, ok := config.Load().OAuthClients[clientID]
+	if !ok {
+		// Compare anyway so unknown and known clients take the same time.
+		expected = clientSecret + "x"
+	}
+	expectedHash := sha256.Sum256([]byte(expected))
+	actualHash := sha256.Sum256([]byte(clientSecret))
+	return subtle.ConstantTimeCompare(expectedHash[:], actualHash[:]) == 1
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/dto"
+)
+
+// Cookies and header of the cookie token transport.
+const (
+	CookieAccessToken  = "access_token"
+	CookieRefreshToken = "refresh_token"
+	CookieCSRFToken    = "csrf_token"
+	HeaderCSRFToken    = "X-CSRF-Token"
+)
+
+// RequireCSRF protects state-changing routes in the cookie transport with a
+// double-submit check: a request carrying token cookies must repeat the
+// csrf_token cookie in the X-CSRF-Token header. Another site can make the
+// browser send the cookies but cannot read them to set the header. Requests
+// authorised with the Authorization header are not affected.
+func RequireCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cookieTransport() || c.GetHeader("Authorization") != "" || !hasTokenCookie(c) {
+			c.Next()
+			return
+		}
+
+		cookie, err := c.Cookie(CookieCSRFToken)
+		header := c.GetHeader(HeaderCSRFToken)
+		if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{
+				Error: "CSRF token is missing or does not match",
+				Code:  "csrf_token_mismatch",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireJSON protects routes that set token cookies without requiring any,
+// like login, in the cookie transport. The double-submit check does not apply
+// to them, so another site could submit a form that logs the browser in to
+// the attacker's account. Browsers send a JSON content type cross-origin only
+// after a CORS preflight, so such a form is rejected with 415.
+func RequireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cookieTransport() && c.ContentType() != gin.MIMEJSON {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, dto.ErrorResponse{
+				Error: "Content-Type must be application/json",
+				Code:  "unsupported_media_type",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func cookieTransport() bool {
+	return config.Load().TokenTransport == config.TokenTransportCookie
+}
+
+// accessTokenCookie returns the access token cookie in the cookie transport
+// and an empty string otherwise.
+func accessTokenCookie(c *gin.Context) string {
+	if !cookieTransport() {
+		return ""
+	}
+	token, _ := c.Cookie(CookieAccessToken)
+	return token
+}
+
+func hasTokenCookie(c *gin.Context) bool {
+	for _, name := range []string{CookieAccessToken, CookieRefreshToken} {
+		if value, err := c.Cookie(name); err == nil && value != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/config"
+)
+
+// withTokenTransport switches the token transport for the duration of the test.
+func withTokenTransport(t *testing.T, transport string) {
+	t.Helper()
+	cfg := config.Load()
+	previous := cfg.TokenTransport
+	cfg.TokenTransport = transport
+	t.Cleanup(func() { cfg.TokenTransport = previous })
+}
+
+func newCSRFRouter() *gin.Engine {
+	router := gin.New()
+	router.POST("/update", RequireCSRF(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/login", RequireJSON(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestRequireCSRF(t *testing.T) {
+	withTokenTransport(t, config.TokenTransportCookie)
+	router := newCSRFRouter()
+
+	tests := []struct {
+		name          string
+		cookies       map[string]string
+		header        string
+		authorization string
+		want          int
+	}{
+		{name: "no token cookies", want: http.StatusOK},
+		{
+			name:    "missing header",
+			cookies: map[string]string{CookieRefreshToken: "refresh", CookieCSRFToken: "csrf"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "wrong header",
+			cookies: map[string]string{CookieAccessToken: "access", CookieCSRFToken: "csrf"},
+			header:  "other",
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "missing csrf cookie",
+			cookies: map[string]string{CookieAccessToken: "access"},
+			header:  "csrf",
+			want:    http.StatusForbidden,
+		},
+		{
+			// Every token issuance replaces the csrf_token cookie, so a
+			// header copied before the refresh no longer matches.
+			name:    "token from before rotation",
+			cookies: map[string]string{CookieAccessToken: "access", CookieCSRFToken: "rotated"},
+			header:  "csrf",
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "matching header",
+			cookies: map[string]string{CookieAccessToken: "access", CookieCSRFToken: "rotated"},
+			header:  "rotated",
+			want:    http.StatusOK,
+		},
+		{
+			name:          "authorization header",
+			cookies:       map[string]string{CookieAccessToken: "access", CookieCSRFToken: "csrf"},
+			authorization: "Bearer access",
+			want:          http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update", nil)
+			for name, value := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			if tt.header != "" {
+				req.Header.Set(HeaderCSRFToken, tt.header)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(rec.Body.String(), "csrf_token_mismatch") {
+				t.Errorf("body = %s, want csrf_token_mismatch", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireCSRFSkipsBodyTransport(t *testing.T) {
+	withTokenTransport(t, config.TokenTransportBody)
+
+	req := httptest.NewRequest(http.MethodPost, "/update", nil)
+	req.AddCookie(&http.Cookie{Name: CookieAccessToken, Value: "access"})
+	rec := httptest.NewRecorder()
+	newCSRFRouter().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestRequireJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		transport   string
+		contentType string
+		want        int
+	}{
+		{name: "cookie transport, json", transport: config.TokenTransportCookie, contentType: "application/json; charset=utf-8", want: http.StatusOK},
+		{name: "cookie transport, form", transport: config.TokenTransportCookie, contentType: "application/x-www-form-urlencoded", want: http.StatusUnsupportedMediaType},
+		{name: "cookie transport, text", transport: config.TokenTransportCookie, contentType: "text/plain", want: http.StatusUnsupportedMediaType},
+		{name: "cookie transport, none", transport: config.TokenTransportCookie, want: http.StatusUnsupportedMediaType},
+		{name: "body transport, text", transport: config.TokenTransportBody, contentType: "text/plain", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTokenTransport(t, tt.transport)
+
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"login":"user","password":"secret"}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			newCSRFRouter().ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
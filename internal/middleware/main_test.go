@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	env := map[string]string{
+		"ACCESS_TOKEN_TTL":     "15m",
+		"JWT_SECRET":           "test-secret",
+		"DB_DSN":               "unused",
+		"WEBHOOK":              "http://127.0.0.1:1/",
+		"REFRESH_TOKEN_PEPPER": "test-pepper",
+	}
+	for key, value := range env {
+		_ = os.Setenv(key, value)
+	}
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
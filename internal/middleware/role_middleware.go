@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/dto"
+)
+
+// RequireRole lets through access tokens carrying at least one of roles. It
+// must run after AuthMiddleware, which puts the token's roles into the
+// context.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, _ := c.Get("roles")
+		grantedRoles, _ := granted.([]string)
+
+		for _, role := range roles {
+			if slices.Contains(grantedRoles, role) {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{
+			Error: "one of roles " + strings.Join(roles, ", ") + " required",
+			Code:  "insufficient_role",
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"medods_test_task/internal/dpop"
+	"medods_test_task/internal/dto"
+	"medods_test_task/internal/utils"
+)
+
+// RequireScopes only lets through access tokens granted every one of scopes.
+// It must run after AuthMiddleware, which puts the token's scopes and the
+// authorization scheme into the context. A missing scope is reported as
+// insufficient_scope in a challenge for that scheme: Bearer per RFC 6750 or
+// DPoP per RFC 9449 section 7.1.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	required := utils.FormatScope(scopes)
+	return func(c *gin.Context) {
+		granted, _ := c.Get("scopes")
+		grantedScopes, _ := granted.([]string)
+
+		if !utils.ContainsScopes(grantedScopes, scopes) {
+			challenge := fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, required)
+			if c.GetString("authScheme") == schemeDPoP {
+				challenge = fmt.Sprintf(`DPoP error="insufficient_scope", scope="%s", algs="%s"`,
+					required, strings.Join(dpop.SupportedAlgorithms(), " "))
+			}
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{
+				Error: "insufficient scope: " + required + " required",
+				Code:  "insufficient_scope",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
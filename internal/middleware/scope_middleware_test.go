@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/dpop"
+	service "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/signing"
+	tokenFormat "medods_test_task/internal/tokenformat/impl"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+// activeSessions treats every session as active.
+type activeSessions struct {
+	service.AuthService
+}
+
+func (activeSessions) IsTokenValid(uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+const protectedURL = "http://example.com/protected"
+
+func newScopedRouter(t *testing.T) (*gin.Engine, tokenFormatIntf.TokenFormat) {
+	t.Helper()
+	key, err := signing.NewSymmetricKey([]byte("test-secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := tokenFormat.NewJWTTokenFormat(signing.NewStaticKeyring(key))
+	verifier := dpop.NewVerifier(time.Minute, 0, 0, nil)
+
+	router := gin.New()
+	router.GET("/protected", AuthMiddleware(activeSessions{}, format, verifier), RequireScopes("records:write"),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router, format
+}
+
+func issueTestToken(t *testing.T, format tokenFormatIntf.TokenFormat, scopes []string, cnf *utils.Confirmation) string {
+	t.Helper()
+	token, err := format.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+		UserID:         uuid.New(),
+		RefreshTokenID: uuid.New(),
+		Scopes:         scopes,
+		Cnf:            cnf,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequireScopesBearer(t *testing.T) {
+	router, format := newScopedRouter(t)
+
+	tests := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{"granted", []string{"records:read", "records:write"}, http.StatusOK},
+		{"missing", []string{"records:read"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, protectedURL, nil)
+			req.Header.Set("Authorization", "Bearer "+issueTestToken(t, format, tt.scopes, nil))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusForbidden {
+				want := `Bearer error="insufficient_scope", scope="records:write"`
+				if got := w.Header().Get("WWW-Authenticate"); got != want {
+					t.Errorf("WWW-Authenticate = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireScopesDPoPChallenge(t *testing.T) {
+	router, format := newScopedRouter(t)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := signing.PublicKeyToJWK(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := signing.Thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken := issueTestToken(t, format, []string{"records:read"}, &utils.Confirmation{JKT: jkt})
+
+	req := httptest.NewRequest(http.MethodGet, protectedURL, nil)
+	req.Header.Set("Authorization", "DPoP "+accessToken)
+	req.Header.Set(dpop.HeaderProof, signTestProof(t, privateKey, jwk, http.MethodGet, protectedURL, accessToken))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body.String())
+	}
+	challenge := w.Header().Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, `DPoP error="insufficient_scope", scope="records:write"`) {
+		t.Errorf("WWW-Authenticate = %q, want a DPoP insufficient_scope challenge", challenge)
+	}
+}
+
+func signTestProof(t *testing.T, privateKey *ecdsa.PrivateKey, jwk interface{}, method, url, accessToken string) string {
+	t.Helper()
+	var jwkHeader map[string]interface{}
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &jwkHeader); err != nil {
+		t.Fatal(err)
+	}
+
+	ath := sha256.Sum256([]byte(accessToken))
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"jti": uuid.NewString(),
+		"htm": method,
+		"htu": url,
+		"iat": time.Now().Unix(),
+		"ath": base64.RawURLEncoding.EncodeToString(ath[:]),
+	})
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = jwkHeader
+	proof, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccessToken is a reference access token. Clients only get a random
+// reference; its claims stay in Claims, serialised as JSON.
+type AccessToken struct {
+	TokenHash      string    `gorm:"primaryKey"`
+	RefreshTokenID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Claims         string    `gorm:"type:jsonb;not null"`
+	ExpiresAt      time.Time `gorm:"not null;index"`
+	CreatedAt      time.Time
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Credential is the password of a user. Login is a username or email,
+// stored lower-cased.
+type Credential struct {
+	UserID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Login        string    `gorm:"not null;uniqueIndex"`
+	PasswordHash string    `gorm:"not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
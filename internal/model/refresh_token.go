@@ -7,11 +7,67 @@ import (
 )
 
 type RefreshToken struct {
-	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	UserID        uuid.UUID  `gorm:"type:uuid;not null;index"`
-	TokenHash     string     `gorm:"not null"`
-	UserAgent     string     `gorm:"not null"`
-	IP            string     `gorm:"not null"`
-	DeactivatedAt *time.Time `gorm:"index"`
-	CreatedAt     time.Time
+	ID                 uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID             uuid.UUID  `gorm:"type:uuid;not null;index"`
+	FamilyID           uuid.UUID  `gorm:"type:uuid;index"`
+	ParentID           *uuid.UUID `gorm:"type:uuid;index"`
+	ActorID            *uuid.UUID `gorm:"type:uuid;index"`
+	TokenHash          string     `gorm:"not null"`
+	UserAgent          string     `gorm:"not null"`
+	IP                 string     `gorm:"not null"`
+	ClientID           string     `gorm:"not null;default:''"`
+	Nonce              string     `gorm:"not null;default:''"`
+	Scope              string     `gorm:"not null;default:''"`
+	ProofKeyThumbprint string     `gorm:"not null;default:''"`
+	CertThumbprint     string     `gorm:"not null;default:''"`
+	DeactivatedAt      *time.Time `gorm:"index"`
+	RotatedAt          *time.Time
+	ExpiresAt          *time.Time
+	SessionExpiresAt   *time.Time `gorm:"index"`
+	AuthenticatedAt    *time.Time
+	CreatedAt          time.Time
+}
+
+// Family returns the ID shared by every token rotated from the same login.
+// Rows created before families were introduced have no FamilyID and form a
+// family of their own.
+func (t *RefreshToken) Family() uuid.UUID {
+	if t.FamilyID == uuid.Nil {
+		return t.ID
+	}
+	return t.FamilyID
+}
+
+// IsImpersonated reports whether the session was opened by ActorID acting
+// as the user through token exchange.
+func (t *RefreshToken) IsImpersonated() bool {
+	return t.ActorID != nil
+}
+
+// IsBound reports whether the session only accepts refreshes from the
+// holder of a DPoP key or TLS client certificate.
+func (t *RefreshToken) IsBound() bool {
+	return t.ProofKeyThumbprint != "" || t.CertThumbprint != ""
+}
+
+// StartedAt returns when the user signed in to the session. Rotation keeps
+// it unchanged, while CreatedAt moves with every refresh.
+func (t *RefreshToken) StartedAt() time.Time {
+	if t.AuthenticatedAt == nil {
+		return t.CreatedAt
+	}
+	return *t.AuthenticatedAt
+}
+
+// IsExpired reports whether the token outlived its own TTL or the absolute
+// lifetime of its session. Rows created before expiry was introduced have
+// no ExpiresAt and fall back to CreatedAt plus fallbackTTL.
+func (t *RefreshToken) IsExpired(now time.Time, fallbackTTL time.Duration) bool {
+	if t.SessionExpiresAt != nil && !now.Before(*t.SessionExpiresAt) {
+		return true
+	}
+	if t.ExpiresAt == nil {
+		return !now.Before(t.CreatedAt.Add(fallbackTTL))
+	}
+	return !now.Before(*t.ExpiresAt)
 }
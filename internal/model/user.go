@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type User struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Status    string    `gorm:"not null;default:'active'"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
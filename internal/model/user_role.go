@@ -0,0 +1,8 @@
+package model
+
+import "github.com/google/uuid"
+
+type UserRole struct {
+	UserID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Role   string    `gorm:"primaryKey"`
+}
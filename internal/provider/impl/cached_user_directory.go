@@ -0,0 +1,90 @@
+package impl
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+// CachedUserDirectory remembers the answers of a remote directory for ttl.
+// Every request with an access token consults the directory, so without it
+// each of them would cost a query or an HTTP call. Failed lookups are not
+// remembered. The cache is local to the instance.
+type CachedUserDirectory struct {
+	directory intf.UserDirectory
+	ttl       time.Duration
+	mu        sync.Mutex
+	users     map[uuid.UUID]cachedUser
+	nextSweep time.Time
+}
+
+type cachedUser struct {
+	user      *intf.User
+	expiresAt time.Time
+}
+
+// NewCachedUserDirectory wraps directory, or returns it as is when ttl is
+// not positive.
+func NewCachedUserDirectory(directory intf.UserDirectory, ttl time.Duration) intf.UserDirectory {
+	if ttl <= 0 {
+		return directory
+	}
+	return &CachedUserDirectory{
+		directory: directory,
+		ttl:       ttl,
+		users:     make(map[uuid.UUID]cachedUser),
+	}
+}
+
+func (d *CachedUserDirectory) User(userID uuid.UUID) (*intf.User, error) {
+	if cached, ok := d.load(userID); ok {
+		if cached.user == nil {
+			return nil, intf.ErrUserNotFound
+		}
+		user := *cached.user
+		return &user, nil
+	}
+
+	user, err := d.directory.User(userID)
+	if err != nil && !errors.Is(err, intf.ErrUserNotFound) {
+		return nil, err
+	}
+	d.store(userID, user)
+	return user, err
+}
+
+func (d *CachedUserDirectory) load(userID uuid.UUID) (cachedUser, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cached, ok := d.users[userID]
+	if !ok || !time.Now().Before(cached.expiresAt) {
+		return cachedUser{}, false
+	}
+	return cached, true
+}
+
+// store remembers user, where nil means that the user does not exist.
+func (d *CachedUserDirectory) store(userID uuid.UUID, user *intf.User) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if !now.Before(d.nextSweep) {
+		for id, cached := range d.users {
+			if !now.Before(cached.expiresAt) {
+				delete(d.users, id)
+			}
+		}
+		d.nextSweep = now.Add(time.Second)
+	}
+	if user != nil {
+		copied := *user
+		user = &copied
+	}
+	d.users[userID] = cachedUser{user: user, expiresAt: now.Add(d.ttl)}
+}
@@ -0,0 +1,145 @@
+package impl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+func TestStaticClaimsEnricher(t *testing.T) {
+	userID := uuid.MustParse("b1506a51-c5a7-45ae-9f2c-4cf700365e46")
+	enricher, err := NewStaticClaimsEnricher(writeFile(t, "claims.yaml", `
+default:
+  locale: ru
+  tenant: default
+users:
+  b1506a51-c5a7-45ae-9f2c-4cf700365e46:
+    tenant: acme
+    clinic_id: 42
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		want   map[string]interface{}
+	}{
+		{
+			name:   "listed user overrides defaults",
+			userID: userID,
+			want:   map[string]interface{}{"locale": "ru", "tenant": "acme", "clinic_id": 42},
+		},
+		{
+			name:   "other user",
+			userID: uuid.New(),
+			want:   map[string]interface{}{"locale": "ru", "tenant": "default"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := enricher.Enrich(intf.ClaimsRequest{UserID: tt.userID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(claims, tt.want) {
+				t.Errorf("claims = %v, want %v", claims, tt.want)
+			}
+		})
+	}
+
+	// Enriching must not change the defaults shared between users.
+	if _, err := enricher.Enrich(intf.ClaimsRequest{UserID: userID}); err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := enricher.Enrich(intf.ClaimsRequest{UserID: uuid.New()})
+	if claims["tenant"] != "default" {
+		t.Errorf("tenant = %v after enriching a listed user, want default", claims["tenant"])
+	}
+}
+
+func TestHTTPClaimsEnricher(t *testing.T) {
+	request := intf.ClaimsRequest{
+		UserID:    uuid.New(),
+		SessionID: uuid.New(),
+		ClientID:  "web",
+		UserAgent: "test",
+		IP:        "127.0.0.1",
+		Scopes:    []string{"profile"},
+		Roles:     []string{"doctor"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got intf.ClaimsRequest
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&got) != nil || !reflect.DeepEqual(got, request) {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"tenant": "acme"}`))
+	}))
+	defer server.Close()
+
+	enricher := NewHTTPClaimsEnricher(server.URL, time.Second, NewEmptyClaimsEnricher())
+	claims, err := enricher.Enrich(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(claims, map[string]interface{}{"tenant": "acme"}) {
+		t.Errorf("claims = %v, want the ones returned by the service", claims)
+	}
+}
+
+// fallbackClaims is a claims enricher with fixed claims.
+type fallbackClaims map[string]interface{}
+
+func (c fallbackClaims) Enrich(intf.ClaimsRequest) (map[string]interface{}, error) {
+	return c, nil
+}
+
+func TestHTTPClaimsEnricherFallsBack(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	malformed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`["not", "an", "object"]`))
+	}))
+	defer malformed.Close()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	tests := []struct {
+		name    string
+		url     string
+		timeout time.Duration
+	}{
+		{name: "error status", url: failing.URL, timeout: time.Second},
+		{name: "malformed response", url: malformed.URL, timeout: time.Second},
+		{name: "timeout", url: slow.URL, timeout: 50 * time.Millisecond},
+	}
+	fallback := fallbackClaims{"locale": "ru"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := NewHTTPClaimsEnricher(tt.url, tt.timeout, fallback).Enrich(intf.ClaimsRequest{UserID: uuid.New()})
+			if err != nil {
+				t.Fatalf("token issuance failed with the enricher down: %v", err)
+			}
+			if !reflect.DeepEqual(claims, map[string]interface{}(fallback)) {
+				t.Errorf("claims = %v, want the fallback claims %v", claims, fallback)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package impl
+
+import "medods_test_task/internal/provider/intf"
+
+// EmptyClaimsEnricher is used when no enricher is configured and as the
+// fallback of HTTPClaimsEnricher without a claims file.
+type EmptyClaimsEnricher struct{}
+
+func NewEmptyClaimsEnricher() intf.ClaimsEnricher {
+	return EmptyClaimsEnricher{}
+}
+
+func (EmptyClaimsEnricher) Enrich(intf.ClaimsRequest) (map[string]interface{}, error) {
+	return nil, nil
+}
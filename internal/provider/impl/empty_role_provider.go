@@ -0,0 +1,19 @@
+package impl
+
+import (
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+// EmptyRoleProvider is used when no role provider is configured. Tokens are
+// then issued without roles.
+type EmptyRoleProvider struct{}
+
+func NewEmptyRoleProvider() intf.RoleProvider {
+	return EmptyRoleProvider{}
+}
+
+func (EmptyRoleProvider) Roles(uuid.UUID) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,19 @@
+package impl
+
+import (
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+// EmptyUserDirectory is used when no user directory is configured. Every
+// user is then treated as existing and active.
+type EmptyUserDirectory struct{}
+
+func NewEmptyUserDirectory() intf.UserDirectory {
+	return EmptyUserDirectory{}
+}
+
+func (EmptyUserDirectory) User(userID uuid.UUID) (*intf.User, error) {
+	return &intf.User{ID: userID, Status: intf.UserStatusActive}, nil
+}
@@ -0,0 +1,65 @@
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+// HTTPClaimsEnricher posts the ClaimsRequest as JSON to a local service and
+// expects a JSON object of claims in response. When the service fails or
+// does not answer within the timeout, the claims of fallback are used so
+// that token issuance does not depend on it.
+type HTTPClaimsEnricher struct {
+	url      string
+	client   *http.Client
+	fallback intf.ClaimsEnricher
+}
+
+func NewHTTPClaimsEnricher(url string, timeout time.Duration, fallback intf.ClaimsEnricher) intf.ClaimsEnricher {
+	return &HTTPClaimsEnricher{
+		url:      url,
+		client:   &http.Client{Timeout: timeout},
+		fallback: fallback,
+	}
+}
+
+func (e *HTTPClaimsEnricher) Enrich(request intf.ClaimsRequest) (map[string]interface{}, error) {
+	claims, err := e.request(request)
+	if err != nil {
+		log.Printf("claims enricher unavailable, using fallback claims: %v", err)
+		return e.fallback.Enrich(request)
+	}
+	return claims, nil
+}
+
+func (e *HTTPClaimsEnricher) request(request intf.ClaimsRequest) (claims map[string]interface{}, err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to request claims: %w", err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request claims: unexpected status %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,61 @@
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+type httpRolesResponse struct {
+	Roles []string `json:"roles"`
+}
+
+// HTTPRoleProvider asks a local service for the roles of a user with
+// GET <url>?user_id=<id>, expecting {"roles": [...]} in response.
+type HTTPRoleProvider struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPRoleProvider(url string, timeout time.Duration) intf.RoleProvider {
+	return &HTTPRoleProvider{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *HTTPRoleProvider) Roles(userID uuid.UUID) (roles []string, err error) {
+	endpoint, err := url.Parse(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid roles url: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("user_id", userID.String())
+	endpoint.RawQuery = query.Encode()
+
+	resp, err := p.client.Get(endpoint.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to request user roles: %w", err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request user roles: unexpected status %s", resp.Status)
+	}
+
+	var body httpRolesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode user roles: %w", err)
+	}
+	return body.Roles, nil
+}
@@ -0,0 +1,66 @@
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+type httpUserResponse struct {
+	Status string `json:"status"`
+}
+
+// HTTPUserDirectory asks a local service about a user with
+// GET <url>?user_id=<id>, expecting {"status": "active"} in response and
+// 404 for unknown users.
+type HTTPUserDirectory struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPUserDirectory(url string, timeout time.Duration) intf.UserDirectory {
+	return &HTTPUserDirectory{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (d *HTTPUserDirectory) User(userID uuid.UUID) (user *intf.User, err error) {
+	endpoint, err := url.Parse(d.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid users url: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("user_id", userID.String())
+	endpoint.RawQuery = query.Encode()
+
+	resp, err := d.client.Get(endpoint.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to request user: %w", err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, intf.ErrUserNotFound
+	default:
+		return nil, fmt.Errorf("failed to request user: unexpected status %s", resp.Status)
+	}
+
+	var body httpUserResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode user: %w", err)
+	}
+	return &intf.User{ID: userID, Status: body.Status}, nil
+}
@@ -0,0 +1,129 @@
+package impl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStaticRoleProvider(t *testing.T) {
+	admin := uuid.MustParse("b1506a51-c5a7-45ae-9f2c-4cf700365e46")
+	provider, err := NewStaticRoleProvider(writeFile(t, "roles.yaml", `
+default: [patient]
+users:
+  b1506a51-c5a7-45ae-9f2c-4cf700365e46: [admin, doctor]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		want   []string
+	}{
+		{name: "listed user", userID: admin, want: []string{"admin", "doctor"}},
+		{name: "other user", userID: uuid.New(), want: []string{"patient"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, err := provider.Roles(tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(roles, tt.want) {
+				t.Errorf("roles = %v, want %v", roles, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticRoleProviderRejectsBadFile(t *testing.T) {
+	if _, err := NewStaticRoleProvider(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("a missing roles file was accepted")
+	}
+	if _, err := NewStaticRoleProvider(writeFile(t, "roles.yaml", "users:\n  not-a-uuid: [admin]\n")); err == nil {
+		t.Error("a roles file keyed by something other than user ids was accepted")
+	}
+}
+
+func TestHTTPRoleProvider(t *testing.T) {
+	userID := uuid.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Query().Get("tenant") != "acme" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Query().Get("user_id") {
+		case userID.String():
+			_, _ = w.Write([]byte(`{"roles": ["doctor"]}`))
+		case "":
+			http.Error(w, "user_id is missing", http.StatusBadRequest)
+		default:
+			_, _ = w.Write([]byte(`not json`))
+		}
+	}))
+	defer server.Close()
+
+	provider := NewHTTPRoleProvider(server.URL+"/roles?tenant=acme", time.Second)
+
+	roles, err := provider.Roles(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roles, []string{"doctor"}) {
+		t.Errorf("roles = %v, want [doctor]", roles)
+	}
+
+	if _, err := provider.Roles(uuid.New()); err == nil {
+		t.Error("a malformed response was accepted")
+	}
+}
+
+func TestHTTPRoleProviderFailures(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		timeout time.Duration
+	}{
+		{name: "error status", url: failing.URL, timeout: time.Second},
+		{name: "timeout", url: slow.URL, timeout: 50 * time.Millisecond},
+		{name: "invalid url", url: "http://[::1", timeout: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Issuing tokens must fail rather than go ahead without roles.
+			if roles, err := NewHTTPRoleProvider(tt.url, tt.timeout).Roles(uuid.New()); err == nil {
+				t.Errorf("roles = %v, want an error", roles)
+			}
+		})
+	}
+}
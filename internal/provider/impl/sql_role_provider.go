@@ -0,0 +1,27 @@
+package impl
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/provider/intf"
+	repoIntf "medods_test_task/internal/repository/intf"
+)
+
+// SQLRoleProvider reads roles from the user_roles table.
+type SQLRoleProvider struct {
+	userRoleRepository repoIntf.UserRoleRepository
+}
+
+func NewSQLRoleProvider(userRoleRepository repoIntf.UserRoleRepository) intf.RoleProvider {
+	return &SQLRoleProvider{userRoleRepository: userRoleRepository}
+}
+
+func (p *SQLRoleProvider) Roles(userID uuid.UUID) ([]string, error) {
+	roles, err := p.userRoleRepository.ListRolesByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user roles: %w", err)
+	}
+	return roles, nil
+}
@@ -0,0 +1,32 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/provider/intf"
+	repoIntf "medods_test_task/internal/repository/intf"
+)
+
+// SQLUserDirectory reads users from the users table.
+type SQLUserDirectory struct {
+	userRepository repoIntf.UserRepository
+}
+
+func NewSQLUserDirectory(userRepository repoIntf.UserRepository) intf.UserDirectory {
+	return &SQLUserDirectory{userRepository: userRepository}
+}
+
+func (d *SQLUserDirectory) User(userID uuid.UUID) (*intf.User, error) {
+	user, err := d.userRepository.GetByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, intf.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	return &intf.User{ID: user.ID, Status: user.Status}, nil
+}
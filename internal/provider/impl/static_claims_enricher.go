@@ -0,0 +1,54 @@
+package impl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+// staticClaims is the layout of the claims file. Per-user claims override
+// the default ones:
+//
+//	default:
+//	  locale: ru
+//	users:
+//	  b1506a51-c5a7-45ae-9f2c-4cf700365e46:
+//	    tenant: acme
+//	    clinic_id: 42
+type staticClaims struct {
+	Default map[string]interface{}               `yaml:"default"`
+	Users   map[uuid.UUID]map[string]interface{} `yaml:"users"`
+}
+
+type StaticClaimsEnricher struct {
+	claims staticClaims
+}
+
+// NewStaticClaimsEnricher reads the claims file once at startup.
+func NewStaticClaimsEnricher(path string) (intf.ClaimsEnricher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read claims file: %w", err)
+	}
+
+	var claims staticClaims
+	if err := yaml.Unmarshal(data, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse claims file: %w", err)
+	}
+	return &StaticClaimsEnricher{claims: claims}, nil
+}
+
+func (e *StaticClaimsEnricher) Enrich(request intf.ClaimsRequest) (map[string]interface{}, error) {
+	claims := make(map[string]interface{}, len(e.claims.Default))
+	for name, value := range e.claims.Default {
+		claims[name] = value
+	}
+	for name, value := range e.claims.Users[request.UserID] {
+		claims[name] = value
+	}
+	return claims, nil
+}
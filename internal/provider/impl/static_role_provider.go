@@ -0,0 +1,47 @@
+package impl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+// staticRoles is the layout of the roles file:
+//
+//	default: [patient]
+//	users:
+//	  b1506a51-c5a7-45ae-9f2c-4cf700365e46: [admin, doctor]
+type staticRoles struct {
+	Default []string               `yaml:"default"`
+	Users   map[uuid.UUID][]string `yaml:"users"`
+}
+
+type StaticRoleProvider struct {
+	roles staticRoles
+}
+
+// NewStaticRoleProvider reads the roles file once at startup. Users missing
+// from it get the default roles.
+func NewStaticRoleProvider(path string) (intf.RoleProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roles file: %w", err)
+	}
+
+	var roles staticRoles
+	if err := yaml.Unmarshal(data, &roles); err != nil {
+		return nil, fmt.Errorf("failed to parse roles file: %w", err)
+	}
+	return &StaticRoleProvider{roles: roles}, nil
+}
+
+func (p *StaticRoleProvider) Roles(userID uuid.UUID) ([]string, error) {
+	if roles, ok := p.roles.Users[userID]; ok {
+		return roles, nil
+	}
+	return p.roles.Default, nil
+}
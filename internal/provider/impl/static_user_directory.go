@@ -0,0 +1,47 @@
+package impl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"medods_test_task/internal/provider/intf"
+)
+
+// staticUsers is the layout of the users file:
+//
+//	users:
+//	  b1506a51-c5a7-45ae-9f2c-4cf700365e46: active
+//	  703ab287-4f6b-4269-9545-b71f4c6a7808: disabled
+type staticUsers struct {
+	Users map[uuid.UUID]string `yaml:"users"`
+}
+
+type StaticUserDirectory struct {
+	users staticUsers
+}
+
+// NewStaticUserDirectory reads the users file once at startup. Users
+// missing from it do not exist.
+func NewStaticUserDirectory(path string) (intf.UserDirectory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var users staticUsers
+	if err := yaml.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse users file: %w", err)
+	}
+	return &StaticUserDirectory{users: users}, nil
+}
+
+func (d *StaticUserDirectory) User(userID uuid.UUID) (*intf.User, error) {
+	status, ok := d.users.Users[userID]
+	if !ok {
+		return nil, intf.ErrUserNotFound
+	}
+	return &intf.User{ID: userID, Status: status}, nil
+}
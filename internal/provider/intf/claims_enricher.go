@@ -0,0 +1,20 @@
+package intf
+
+import "github.com/google/uuid"
+
+// ClaimsRequest describes the session an access token is issued for.
+type ClaimsRequest struct {
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"session_id"`
+	ClientID  string    `json:"client_id,omitempty"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+}
+
+// ClaimsEnricher returns extra claims to merge into the access token.
+// Reserved claims in the result are dropped.
+type ClaimsEnricher interface {
+	Enrich(request ClaimsRequest) (map[string]interface{}, error)
+}
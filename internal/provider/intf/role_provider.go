@@ -0,0 +1,8 @@
+package intf
+
+import "github.com/google/uuid"
+
+// RoleProvider resolves the roles of a user when tokens are issued.
+type RoleProvider interface {
+	Roles(userID uuid.UUID) ([]string, error)
+}
@@ -0,0 +1,32 @@
+package intf
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// User statuses. Only active users may sign in or refresh tokens.
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusBlocked  = "blocked"
+)
+
+// User is what a UserDirectory knows about a user.
+type User struct {
+	ID     uuid.UUID `json:"id"`
+	Status string    `json:"status"`
+}
+
+func (u *User) IsActive() bool {
+	return u.Status == UserStatusActive
+}
+
+// UserDirectory looks up users when tokens are issued and refreshed. It
+// returns ErrUserNotFound for unknown users.
+type UserDirectory interface {
+	User(userID uuid.UUID) (*User, error)
+}
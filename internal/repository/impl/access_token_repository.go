@@ -0,0 +1,50 @@
+package impl
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/repository/intf"
+)
+
+type AccessTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenRepository(db *gorm.DB) intf.AccessTokenRepository {
+	return &AccessTokenRepositoryImpl{db: db}
+}
+
+func (r *AccessTokenRepositoryImpl) Create(token *model.AccessToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *AccessTokenRepositoryImpl) GetByHash(tokenHash string) (*model.AccessToken, error) {
+	var token model.AccessToken
+	err := r.db.
+		Where("token_hash = ?", tokenHash).
+		First(&token).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *AccessTokenRepositoryImpl) Delete(tokenHash string) error {
+	return r.db.
+		Where("token_hash = ?", tokenHash).
+		Delete(&model.AccessToken{}).Error
+}
+
+// DeleteExpiredBefore removes references that expired before the given
+// time and returns how many were removed.
+func (r *AccessTokenRepositoryImpl) DeleteExpiredBefore(before time.Time) (int64, error) {
+	result := r.db.
+		Where("expires_at < ?", before).
+		Delete(&model.AccessToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,73 @@
+package impl
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/repository/intf"
+)
+
+type CredentialRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewCredentialRepository(db *gorm.DB) intf.CredentialRepository {
+	return &CredentialRepositoryImpl{db: db}
+}
+
+// Save creates the credential or replaces the login and password of an
+// existing one.
+func (r *CredentialRepositoryImpl) Save(credential *model.Credential) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"login", "password_hash", "updated_at"}),
+	}).Create(credential).Error
+}
+
+func (r *CredentialRepositoryImpl) GetByLogin(login string) (*model.Credential, error) {
+	var credential model.Credential
+	err := r.db.
+		Where("login = ?", login).
+		First(&credential).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+func (r *CredentialRepositoryImpl) GetByUserID(userID uuid.UUID) (*model.Credential, error) {
+	var credential model.Credential
+	err := r.db.
+		Where("user_id = ?", userID).
+		First(&credential).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+// UpdatePasswordHash replaces the hash only if it is still the one loaded
+// into credential, which is the one the caller verified, and reports
+// whether it did. A hash changed meanwhile, by a password change, is kept.
+func (r *CredentialRepositoryImpl) UpdatePasswordHash(credential *model.Credential, passwordHash string) (bool, error) {
+	result := r.db.Model(&model.Credential{}).
+		Where("user_id = ? AND password_hash = ?", credential.UserID, credential.PasswordHash).
+		Updates(map[string]interface{}{
+			"password_hash": passwordHash,
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	credential.PasswordHash = passwordHash
+	return true, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"medods_test_task/internal/model"
 	"medods_test_task/internal/repository/intf"
@@ -18,6 +19,21 @@ func NewRefreshTokenRepository(db *gorm.DB) intf.RefreshTokenRepository {
 	return &RefreshTokenRepositoryImpl{db: db}
 }
 
+// WithTransaction runs fn against a repository bound to a single database
+// transaction, committing if fn returns nil and rolling back otherwise.
+func (r *RefreshTokenRepositoryImpl) WithTransaction(fn func(repo intf.RefreshTokenRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&RefreshTokenRepositoryImpl{db: tx})
+	})
+}
+
+// LockUserSessions serialises session changes of one user until the end of
+// the current transaction. An advisory lock is used because a user with no
+// sessions yet has no rows to lock.
+func (r *RefreshTokenRepositoryImpl) LockUserSessions(userID uuid.UUID) error {
+	return r.db.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", userID.String()).Error
+}
+
 func (r *RefreshTokenRepositoryImpl) Create(token *model.RefreshToken) error {
 	return r.db.Create(token).Error
 }
@@ -36,12 +52,45 @@ func (r *RefreshTokenRepositoryImpl) GetByID(refreshTokenID uuid.UUID) (*model.R
 	return &token, nil
 }
 
+func (r *RefreshTokenRepositoryImpl) GetByIDWithDeactivated(refreshTokenID uuid.UUID) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := r.db.
+		Where("id = ?", refreshTokenID).
+		First(&token).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
 func (r *RefreshTokenRepositoryImpl) MarkAsDeactivated(token *model.RefreshToken) error {
 	now := time.Now()
 	token.DeactivatedAt = &now
 	return r.db.Save(token).Error
 }
 
+// MarkAsRotated deactivates the token only if it is still active and
+// reports whether it did. Concurrent callers are serialised by the row lock
+// taken by UPDATE, so exactly one of them gets true.
+func (r *RefreshTokenRepositoryImpl) MarkAsRotated(token *model.RefreshToken) (bool, error) {
+	now := time.Now()
+	result := r.db.Model(&model.RefreshToken{}).
+		Where("id = ? AND deactivated_at IS NULL", token.ID).
+		Updates(map[string]interface{}{
+			"deactivated_at": now,
+			"rotated_at":     now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	token.DeactivatedAt = &now
+	token.RotatedAt = &now
+	return true, nil
+}
+
 func (r *RefreshTokenRepositoryImpl) MarkAllAsDeactivatedByUserID(userID uuid.UUID) error {
 	now := time.Now()
 	return r.db.Model(&model.RefreshToken{}).
@@ -50,10 +99,109 @@ func (r *RefreshTokenRepositoryImpl) MarkAllAsDeactivatedByUserID(userID uuid.UU
 		Error
 }
 
+func (r *RefreshTokenRepositoryImpl) MarkAllAsDeactivatedByActorID(actorID uuid.UUID) error {
+	now := time.Now()
+	return r.db.Model(&model.RefreshToken{}).
+		Where("actor_id = ? AND deactivated_at IS NULL", actorID).
+		Update("deactivated_at", now).
+		Error
+}
+
+func (r *RefreshTokenRepositoryImpl) MarkFamilyAsDeactivated(familyID uuid.UUID) error {
+	now := time.Now()
+	return r.db.Model(&model.RefreshToken{}).
+		Where("(family_id = ? OR id = ?) AND deactivated_at IS NULL", familyID, familyID).
+		Update("deactivated_at", now).
+		Error
+}
+
+func (r *RefreshTokenRepositoryImpl) ListActiveByUserID(userID uuid.UUID) ([]model.RefreshToken, error) {
+	var tokens []model.RefreshToken
+	err := r.db.
+		Scopes(activeSessions(userID)).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// CountActiveByUserID counts the sessions the user opened personally.
+// Impersonated sessions do not count towards the session limit.
+func (r *RefreshTokenRepositoryImpl) CountActiveByUserID(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.RefreshToken{}).
+		Scopes(activeSessions(userID)).
+		Where("actor_id IS NULL").
+		Count(&count).Error
+	return count, err
+}
+
+// EvictOldestActiveByUserID deactivates the count oldest sessions of the
+// user and returns the rows it actually deactivated. Rotation does not take
+// the user lock, so a selected token may be rotated before the UPDATE runs;
+// such a token is skipped and its successor is picked up on the next pass.
+func (r *RefreshTokenRepositoryImpl) EvictOldestActiveByUserID(userID uuid.UUID, count int) ([]model.RefreshToken, error) {
+	var evicted []model.RefreshToken
+	for len(evicted) < count {
+		var ids []uuid.UUID
+		err := r.db.Model(&model.RefreshToken{}).
+			Scopes(activeSessions(userID)).
+			Where("actor_id IS NULL").
+			Order("COALESCE(authenticated_at, created_at) ASC").
+			Limit(count-len(evicted)).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return evicted, err
+		}
+
+		var tokens []model.RefreshToken
+		err = r.db.Model(&tokens).
+			Clauses(clause.Returning{}).
+			Where("id IN ? AND deactivated_at IS NULL", ids).
+			Update("deactivated_at", time.Now()).
+			Error
+		if err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, tokens...)
+	}
+	return evicted, nil
+}
+
+func (r *RefreshTokenRepositoryImpl) MarkFamilyAsDeactivatedByUserID(userID, familyID uuid.UUID) (bool, error) {
+	now := time.Now()
+	result := r.db.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND (family_id = ? OR id = ?) AND deactivated_at IS NULL", userID, familyID, familyID).
+		Update("deactivated_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *RefreshTokenRepositoryImpl) MarkAllAsDeactivatedByUserIDExceptFamily(userID, familyID uuid.UUID) error {
+	now := time.Now()
+	return r.db.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND deactivated_at IS NULL", userID).
+		Where("(family_id IS NULL OR family_id <> ?) AND id <> ?", familyID, familyID).
+		Update("deactivated_at", now).
+		Error
+}
+
 func (r *RefreshTokenRepositoryImpl) IsTokenActive(refreshTokenID uuid.UUID) (bool, error) {
 	var count int64
 	err := r.db.Model(&model.RefreshToken{}).
 		Where("id = ? AND deactivated_at IS NULL", refreshTokenID).
+		Where("session_expires_at IS NULL OR session_expires_at > ?", time.Now()).
 		Count(&count).Error
 	return count > 0, err
 }
+
+// activeSessions selects the refresh tokens of userID that can still be
+// exchanged: not deactivated and not past their own or their session's
+// expiry.
+func activeSessions(userID uuid.UUID) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		now := time.Now()
+		return db.
+			Where("user_id = ? AND deactivated_at IS NULL", userID).
+			Where("session_expires_at IS NULL OR session_expires_at > ?", now).
+			Where("expires_at IS NULL OR expires_at > ?", now)
+	}
+}
@@ -0,0 +1,30 @@
+package impl
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/repository/intf"
+)
+
+type UserRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewUserRepository(db *gorm.DB) intf.UserRepository {
+	return &UserRepositoryImpl{db: db}
+}
+
+func (r *UserRepositoryImpl) GetByID(userID uuid.UUID) (*model.User, error) {
+	var user model.User
+	err := r.db.
+		Where("id = ?", userID).
+		First(&user).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
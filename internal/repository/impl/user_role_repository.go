@@ -0,0 +1,27 @@
+package impl
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/repository/intf"
+)
+
+type UserRoleRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewUserRoleRepository(db *gorm.DB) intf.UserRoleRepository {
+	return &UserRoleRepositoryImpl{db: db}
+}
+
+func (r *UserRoleRepositoryImpl) ListRolesByUserID(userID uuid.UUID) ([]string, error) {
+	var roles []string
+	err := r.db.Model(&model.UserRole{}).
+		Where("user_id = ?", userID).
+		Order("role").
+		Pluck("role", &roles).
+		Error
+	return roles, err
+}
@@ -0,0 +1,14 @@
+package intf
+
+import (
+	"time"
+
+	"medods_test_task/internal/model"
+)
+
+type AccessTokenRepository interface {
+	Create(token *model.AccessToken) error
+	GetByHash(tokenHash string) (*model.AccessToken, error)
+	Delete(tokenHash string) error
+	DeleteExpiredBefore(before time.Time) (int64, error)
+}
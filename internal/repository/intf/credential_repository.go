@@ -0,0 +1,14 @@
+package intf
+
+import (
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/model"
+)
+
+type CredentialRepository interface {
+	Save(credential *model.Credential) error
+	GetByLogin(login string) (*model.Credential, error)
+	GetByUserID(userID uuid.UUID) (*model.Credential, error)
+	UpdatePasswordHash(credential *model.Credential, passwordHash string) (bool, error)
+}
@@ -7,9 +7,20 @@ import (
 )
 
 type RefreshTokenRepository interface {
+	WithTransaction(fn func(repo RefreshTokenRepository) error) error
+	LockUserSessions(userID uuid.UUID) error
 	Create(token *model.RefreshToken) error
 	GetByID(refreshTokenID uuid.UUID) (*model.RefreshToken, error)
+	GetByIDWithDeactivated(refreshTokenID uuid.UUID) (*model.RefreshToken, error)
 	MarkAsDeactivated(token *model.RefreshToken) error
+	MarkAsRotated(token *model.RefreshToken) (bool, error)
 	MarkAllAsDeactivatedByUserID(userID uuid.UUID) error
+	MarkAllAsDeactivatedByActorID(actorID uuid.UUID) error
+	MarkFamilyAsDeactivated(familyID uuid.UUID) error
+	ListActiveByUserID(userID uuid.UUID) ([]model.RefreshToken, error)
+	MarkFamilyAsDeactivatedByUserID(userID, familyID uuid.UUID) (bool, error)
+	MarkAllAsDeactivatedByUserIDExceptFamily(userID, familyID uuid.UUID) error
+	CountActiveByUserID(userID uuid.UUID) (int64, error)
+	EvictOldestActiveByUserID(userID uuid.UUID, count int) ([]model.RefreshToken, error)
 	IsTokenActive(refreshTokenID uuid.UUID) (bool, error)
 }
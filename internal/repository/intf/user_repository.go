@@ -0,0 +1,11 @@
+package intf
+
+import (
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/model"
+)
+
+type UserRepository interface {
+	GetByID(userID uuid.UUID) (*model.User, error)
+}
@@ -0,0 +1,7 @@
+package intf
+
+import "github.com/google/uuid"
+
+type UserRoleRepository interface {
+	ListRolesByUserID(userID uuid.UUID) ([]string, error)
+}
@@ -1,77 +1,364 @@
 package impl
 
 import (
+	"errors"
 	"fmt"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"time"
 
 	"github.com/google/uuid"
 
+	"medods_test_task/internal/config"
 	"medods_test_task/internal/model"
+	providerIntf "medods_test_task/internal/provider/intf"
 	repoIntf "medods_test_task/internal/repository/intf"
 	serviceIntf "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/signing"
+	tokenFormatIntf "medods_test_task/internal/tokenformat/intf"
 	"medods_test_task/internal/utils"
 )
 
+var errRotationLost = errors.New("refresh token rotated concurrently")
+
 type AuthServiceImpl struct {
 	refreshTokenRepository repoIntf.RefreshTokenRepository
+	keyring                *signing.Keyring
+	tokenFormat            tokenFormatIntf.TokenFormat
+	roleProvider           providerIntf.RoleProvider
+	claimsEnricher         providerIntf.ClaimsEnricher
+	userDirectory          providerIntf.UserDirectory
+	graceCache             *refreshGraceCache
+	rotationLocks          *keyedMutex
 }
 
-func NewAuthService(refreshTokenRepository repoIntf.RefreshTokenRepository) serviceIntf.AuthService {
-	return &AuthServiceImpl{refreshTokenRepository: refreshTokenRepository}
+func NewAuthService(refreshTokenRepository repoIntf.RefreshTokenRepository, keyring *signing.Keyring, tokenFormat tokenFormatIntf.TokenFormat, roleProvider providerIntf.RoleProvider, claimsEnricher providerIntf.ClaimsEnricher, userDirectory providerIntf.UserDirectory) serviceIntf.AuthService {
+	return &AuthServiceImpl{
+		refreshTokenRepository: refreshTokenRepository,
+		keyring:                keyring,
+		tokenFormat:            tokenFormat,
+		roleProvider:           roleProvider,
+		claimsEnricher:         claimsEnricher,
+		userDirectory:          userDirectory,
+		graceCache:             newRefreshGraceCache(),
+		rotationLocks:          newKeyedMutex(),
+	}
 }
 
-func (s *AuthServiceImpl) CreateTokens(userID uuid.UUID, userAgent, ip string) (string, string, error) {
+func (s *AuthServiceImpl) CreateTokens(request serviceIntf.TokenRequest) (*serviceIntf.Tokens, error) {
+	if supported := config.Load().SupportedScopes; len(supported) > 0 && !utils.ContainsScopes(supported, request.Scopes) {
+		return nil, serviceIntf.ErrInvalidScope
+	}
+
+	if err := s.checkUser(request.UserID, false); err != nil {
+		return nil, err
+	}
+	scopes := utils.IntersectScopes(request.Scopes, clientScopes(request))
+
+	rawRefreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	hashedRefreshToken := utils.HashRefreshToken(rawRefreshToken)
+
 	refreshTokenID := uuid.New()
-	accessToken, err := utils.GenerateAccessToken(refreshTokenID)
+	userID := request.UserID
+	now := time.Now()
+	sessionExpiresAt := sessionExpiry(now)
+	refreshTokenModel := &model.RefreshToken{
+		ID:                 refreshTokenID,
+		UserID:             userID,
+		FamilyID:           refreshTokenID,
+		TokenHash:          hashedRefreshToken,
+		UserAgent:          request.UserAgent,
+		IP:                 request.IP,
+		ClientID:           request.ClientID,
+		Nonce:              request.Nonce,
+		Scope:              utils.FormatScope(scopes),
+		ProofKeyThumbprint: request.Binding.JKT,
+		CertThumbprint:     request.Binding.X5T,
+		ExpiresAt:          refreshTokenExpiry(now, sessionExpiresAt),
+		SessionExpiresAt:   sessionExpiresAt,
+		AuthenticatedAt:    &now,
+		CreatedAt:          now,
+	}
+
+	tokens, err := s.issueTokens(refreshTokenModel, rawRefreshToken, scopes)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate access token: %w", err)
+		return nil, err
 	}
 
-	rawRefreshToken, err := utils.GenerateRefreshToken()
+	var evicted []model.RefreshToken
+	err = s.refreshTokenRepository.WithTransaction(func(repo repoIntf.RefreshTokenRepository) error {
+		var err error
+		if evicted, err = enforceSessionLimit(repo, userID); err != nil {
+			return err
+		}
+		if err := repo.Create(refreshTokenModel); err != nil {
+			return fmt.Errorf("failed to save refresh token to database: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+		s.discardAccessToken(tokens.AccessToken)
+		return nil, err
+	}
+
+	for _, session := range evicted {
+		s.notifySessionEvicted(session, refreshTokenModel)
 	}
 
-	hashedRefreshToken, err := bcrypt.GenerateFromPassword([]byte(rawRefreshToken), bcrypt.DefaultCost)
+	return tokens, nil
+}
+
+// issueTokens issues the access token and signs the id_token for the refresh token
+// about to be stored. The access token carries scopes, which may be
+// narrower than the scope granted to the session, and is bound like the
+// session. No id_token is issued under HS512: clients could not verify it
+// without the server secret.
+func (s *AuthServiceImpl) issueTokens(refreshTokenModel *model.RefreshToken, rawRefreshToken string, scopes []string) (*serviceIntf.Tokens, error) {
+	binding := sessionBinding(refreshTokenModel)
+	accessToken, err := s.issueAccessToken(refreshTokenModel, scopes, sessionActor(refreshTokenModel), binding)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to hash refresh token: %w", err)
+		return nil, err
 	}
 
-	refreshTokenModel := &model.RefreshToken{
-		ID:        refreshTokenID,
-		UserID:    userID,
-		TokenHash: string(hashedRefreshToken),
-		UserAgent: userAgent,
-		IP:        ip,
-		CreatedAt: time.Now(),
+	var idToken string
+	if key := s.keyring.Active(); !key.IsSymmetric() {
+		idToken, err = utils.GenerateIDToken(key, refreshTokenModel)
+		if err != nil {
+			s.discardAccessToken(accessToken)
+			return nil, fmt.Errorf("failed to generate id token: %w", err)
+		}
+	}
+
+	return &serviceIntf.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: utils.FormatRefreshToken(refreshTokenModel.ID, rawRefreshToken),
+		IDToken:      idToken,
+		Scopes:       scopes,
+		Binding:      binding,
+	}, nil
+}
+
+// discardAccessToken withdraws an access token issued for a session that
+// could not be saved, so a stored reference token does not outlive it.
+func (s *AuthServiceImpl) discardAccessToken(accessToken string) {
+	if err := s.tokenFormat.Discard(accessToken); err != nil {
+		log.Printf("failed to discard access token: %v", err)
+	}
+}
+
+// issueAccessToken issues an access token for the session in the configured
+// format. Roles and enriched claims are resolved anew every time, so changes
+// take effect with the next refresh.
+func (s *AuthServiceImpl) issueAccessToken(refreshTokenModel *model.RefreshToken, scopes []string, act *utils.Actor, binding serviceIntf.Binding) (string, error) {
+	roles, err := s.roleProvider.Roles(refreshTokenModel.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve user roles: %w", err)
 	}
 
-	if err = s.refreshTokenRepository.Create(refreshTokenModel); err != nil {
-		return "", "", fmt.Errorf("failed to save refresh token to database: %w", err)
+	extra, err := s.claimsEnricher.Enrich(providerIntf.ClaimsRequest{
+		UserID:    refreshTokenModel.UserID,
+		SessionID: refreshTokenModel.Family(),
+		ClientID:  refreshTokenModel.ClientID,
+		UserAgent: refreshTokenModel.UserAgent,
+		IP:        refreshTokenModel.IP,
+		Scopes:    scopes,
+		Roles:     roles,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to enrich claims: %w", err)
+	}
+	extra, dropped := utils.FilterReservedClaims(extra)
+	if len(dropped) > 0 {
+		log.Printf("claims enricher returned reserved claims, ignored: %v", dropped)
 	}
 
-	return accessToken, rawRefreshToken, nil
+	accessToken, err := s.tokenFormat.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+		UserID:         refreshTokenModel.UserID,
+		RefreshTokenID: refreshTokenModel.ID,
+		Scopes:         scopes,
+		Roles:          roles,
+		Act:            act,
+		Cnf:            confirmation(binding),
+		Extra:          extra,
+	}))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+	return accessToken, nil
 }
 
-func (s *AuthServiceImpl) UpdateTokens(refreshTokenID uuid.UUID, rawRefreshToken, userAgent, ip string) (string, string, error) {
-	refreshTokenModel, err := s.refreshTokenRepository.GetByID(refreshTokenID)
+// sessionActor returns the act claim of an impersonated session.
+func sessionActor(refreshTokenModel *model.RefreshToken) *utils.Actor {
+	if !refreshTokenModel.IsImpersonated() {
+		return nil
+	}
+	return &utils.Actor{Sub: refreshTokenModel.ActorID.String()}
+}
+
+// sessionBinding returns what the session and its tokens are bound to.
+func sessionBinding(refreshTokenModel *model.RefreshToken) serviceIntf.Binding {
+	return serviceIntf.Binding{
+		JKT: refreshTokenModel.ProofKeyThumbprint,
+		X5T: refreshTokenModel.CertThumbprint,
+	}
+}
+
+// bindingMatches reports whether binding satisfies every binding of the
+// session. An unbound session accepts any request.
+func bindingMatches(refreshTokenModel *model.RefreshToken, binding serviceIntf.Binding) bool {
+	return (refreshTokenModel.ProofKeyThumbprint == "" || refreshTokenModel.ProofKeyThumbprint == binding.JKT) &&
+		(refreshTokenModel.CertThumbprint == "" || refreshTokenModel.CertThumbprint == binding.X5T)
+}
+
+// clientMatches reports whether clientID may redeem the refresh token. A
+// token issued to a confidential client from OAUTH_CLIENTS is only redeemed
+// by that client, authenticated (RFC 6749 section 6); a token issued to a
+// public client is not redeemed by another one.
+func clientMatches(refreshTokenModel *model.RefreshToken, clientID string) bool {
+	if refreshTokenModel.ClientID == "" || refreshTokenModel.ClientID == clientID {
+		return true
+	}
+	_, confidential := config.Load().OAuthClients[refreshTokenModel.ClientID]
+	return !confidential && clientID == ""
+}
+
+func confirmation(binding serviceIntf.Binding) *utils.Confirmation {
+	if binding.IsZero() {
+		return nil
+	}
+	return &utils.Confirmation{JKT: binding.JKT, X5TS256: binding.X5T}
+}
+
+// enforceSessionLimit makes room for one more session of userID according
+// to MAX_SESSIONS_PER_USER and SESSION_LIMIT_POLICY. It must run in the same
+// transaction as the insert of the new session.
+func enforceSessionLimit(repo repoIntf.RefreshTokenRepository, userID uuid.UUID) ([]model.RefreshToken, error) {
+	cfg := config.Load()
+	if cfg.MaxSessionsPerUser <= 0 {
+		return nil, nil
+	}
+
+	if err := repo.LockUserSessions(userID); err != nil {
+		return nil, fmt.Errorf("failed to lock user sessions: %w", err)
+	}
+
+	count, err := repo.CountActiveByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count user sessions: %w", err)
+	}
+
+	excess := int(count) - cfg.MaxSessionsPerUser + 1
+	if excess <= 0 {
+		return nil, nil
+	}
+
+	if cfg.SessionLimitPolicy == config.SessionLimitPolicyReject {
+		return nil, serviceIntf.ErrSessionLimitReached
+	}
+
+	evicted, err := repo.EvictOldestActiveByUserID(userID, excess)
 	if err != nil {
-		return "", "", fmt.Errorf("refresh token not found: %w", err)
+		return nil, fmt.Errorf("failed to evict oldest sessions: %w", err)
+	}
+	return evicted, nil
+}
+
+func (s *AuthServiceImpl) notifySessionEvicted(session model.RefreshToken, newSession *model.RefreshToken) {
+	go func() {
+		details := map[string]interface{}{
+			"session_id":     session.Family().String(),
+			"ip":             session.IP,
+			"user_agent":     session.UserAgent,
+			"new_session_id": newSession.Family().String(),
+			"new_ip":         newSession.IP,
+		}
+		if err := utils.SendEventToWebhook(utils.EventSessionEvicted, session.UserID, details); err != nil {
+			log.Printf("failed to send webhook event: %v", err)
+		}
+	}()
+}
+
+func (s *AuthServiceImpl) UpdateTokens(request serviceIntf.RefreshRequest) (*serviceIntf.Tokens, error) {
+	refreshTokenID, userAgent, ip := request.RefreshTokenID, request.UserAgent, request.IP
+	embeddedID, secret := utils.SplitRefreshToken(request.RefreshToken)
+	if embeddedID != uuid.Nil {
+		if refreshTokenID != uuid.Nil && refreshTokenID != embeddedID {
+			return nil, serviceIntf.ErrInvalidRefreshToken
+		}
+		refreshTokenID = embeddedID
 	}
+	if refreshTokenID == uuid.Nil {
+		return nil, serviceIntf.ErrRefreshTokenIDMissing
+	}
+
+	unlock := s.rotationLocks.lock(refreshTokenID)
+	defer unlock()
 
-	if err := bcrypt.CompareHashAndPassword([]byte(refreshTokenModel.TokenHash), []byte(rawRefreshToken)); err != nil {
-		return "", "", fmt.Errorf("invalid refresh token")
+	refreshTokenModel, err := s.refreshTokenRepository.GetByIDWithDeactivated(refreshTokenID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", serviceIntf.ErrRefreshTokenNotFound, err)
+	}
+
+	if !utils.VerifyRefreshToken(refreshTokenModel.TokenHash, secret) {
+		return nil, serviceIntf.ErrInvalidRefreshToken
+	}
+
+	// A bound refresh token is useless without the key or certificate it is
+	// bound to, so presenting it without them is not treated as reuse.
+	if !bindingMatches(refreshTokenModel, request.Binding) {
+		return nil, serviceIntf.ErrTokenBindingMismatch
+	}
+	if !clientMatches(refreshTokenModel, request.ClientID) {
+		return nil, serviceIntf.ErrClientMismatch
+	}
+
+	if refreshTokenModel.DeactivatedAt != nil {
+		if refreshTokenModel.RotatedAt == nil {
+			return nil, serviceIntf.ErrRefreshTokenNotFound
+		}
+		if result, ok := s.graceCache.load(refreshTokenModel.ID); ok && result.userAgent == userAgent {
+			return result.tokens, nil
+		}
+		// Inside the grace period the token is not treated as reused even
+		// when the pair it was rotated into is unknown here, as after a
+		// restart or on another instance.
+		if time.Now().Before(refreshTokenModel.RotatedAt.Add(config.Load().RefreshGracePeriod)) {
+			return nil, serviceIntf.ErrRefreshConflict
+		}
+		return nil, s.handleRefreshTokenReuse(refreshTokenModel, userAgent, ip)
+	}
+
+	if refreshTokenModel.IsExpired(time.Now(), config.Load().RefreshTokenTTL) {
+		if err := s.refreshTokenRepository.MarkAsDeactivated(refreshTokenModel); err != nil {
+			return nil, fmt.Errorf("failed to deactivate expired refresh token: %w", err)
+		}
+		return nil, serviceIntf.ErrRefreshTokenExpired
+	}
+
+	if err := s.checkSessionUsers(refreshTokenModel); err != nil {
+		return nil, err
+	}
+
+	// A refresh may narrow the scope of the access token but never widen it.
+	// The new refresh token keeps the scope granted at sign-in.
+	scopes := utils.ParseScope(refreshTokenModel.Scope)
+	if request.Scopes != nil {
+		if !utils.ContainsScopes(scopes, request.Scopes) {
+			return nil, serviceIntf.ErrInvalidScope
+		}
+		scopes = request.Scopes
 	}
 
 	userID := refreshTokenModel.UserID
 
 	if refreshTokenModel.UserAgent != userAgent {
 		if err := s.refreshTokenRepository.MarkAllAsDeactivatedByUserID(userID); err != nil {
-			return "", "", fmt.Errorf("failed to deauthorize user: %w", err)
+			return nil, fmt.Errorf("failed to deauthorize user: %w", err)
 		}
-		return "", "", fmt.Errorf("user-agent mismatch. user deauthorized")
+		return nil, serviceIntf.ErrUserAgentMismatch
 	}
 
 	if refreshTokenModel.IP != ip {
@@ -82,42 +369,207 @@ func (s *AuthServiceImpl) UpdateTokens(refreshTokenID uuid.UUID, rawRefreshToken
 		}()
 	}
 
-	if err := s.refreshTokenRepository.MarkAsDeactivated(refreshTokenModel); err != nil {
-		return "", "", fmt.Errorf("failed to mark refresh token as used: %w", err)
+	newRawRefreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
+	newHashedRefreshHash := utils.HashRefreshToken(newRawRefreshToken)
 
-	newRefreshTokenID := uuid.New()
-	newAccessToken, err := utils.GenerateAccessToken(newRefreshTokenID)
+	now := time.Now()
+	sessionExpiresAt := refreshTokenModel.SessionExpiresAt
+	if sessionExpiresAt == nil {
+		sessionExpiresAt = sessionExpiry(now)
+	}
+	authenticatedAt := refreshTokenModel.StartedAt()
+	newRefreshToken := &model.RefreshToken{
+		ID:                 uuid.New(),
+		UserID:             userID,
+		FamilyID:           refreshTokenModel.Family(),
+		ParentID:           &refreshTokenModel.ID,
+		ActorID:            refreshTokenModel.ActorID,
+		TokenHash:          newHashedRefreshHash,
+		UserAgent:          userAgent,
+		IP:                 ip,
+		ClientID:           refreshTokenModel.ClientID,
+		Nonce:              refreshTokenModel.Nonce,
+		Scope:              refreshTokenModel.Scope,
+		ProofKeyThumbprint: refreshTokenModel.ProofKeyThumbprint,
+		CertThumbprint:     refreshTokenModel.CertThumbprint,
+		ExpiresAt:          refreshTokenExpiry(now, sessionExpiresAt),
+		SessionExpiresAt:   sessionExpiresAt,
+		AuthenticatedAt:    &authenticatedAt,
+		CreatedAt:          now,
+	}
+
+	tokens, err := s.issueTokens(newRefreshToken, newRawRefreshToken, scopes)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate access token: %w", err)
+		return nil, err
 	}
 
-	newRawRefreshToken, err := utils.GenerateRefreshToken()
+	// Only one of several concurrent refreshes with the same token may win.
+	// MarkAsRotated is conditional on the token still being active, and the
+	// child is inserted in the same transaction, so a loser leaves no trace.
+	err = s.refreshTokenRepository.WithTransaction(func(repo repoIntf.RefreshTokenRepository) error {
+		rotated, err := repo.MarkAsRotated(refreshTokenModel)
+		if err != nil {
+			return fmt.Errorf("failed to mark refresh token as used: %w", err)
+		}
+		if !rotated {
+			return errRotationLost
+		}
+		if err := repo.Create(newRefreshToken); err != nil {
+			return fmt.Errorf("failed to save new refresh token: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+		s.discardAccessToken(tokens.AccessToken)
+	}
+	if errors.Is(err, errRotationLost) {
+		return nil, s.rotationLostError(refreshTokenModel.ID)
 	}
-	newHashedRefreshHash, err := bcrypt.GenerateFromPassword([]byte(newRawRefreshToken), bcrypt.DefaultCost)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to hash refresh token: %w", err)
+		return nil, err
 	}
 
-	newRefreshToken := &model.RefreshToken{
-		ID:        newRefreshTokenID,
-		UserID:    userID,
-		TokenHash: string(newHashedRefreshHash),
-		UserAgent: userAgent,
-		IP:        ip,
-		CreatedAt: time.Now(),
+	if grace := config.Load().RefreshGracePeriod; grace > 0 {
+		s.graceCache.store(refreshTokenModel.ID, rotationResult{
+			tokens:    tokens,
+			userAgent: userAgent,
+			expiresAt: refreshTokenModel.RotatedAt.Add(grace),
+		})
+	}
+
+	return tokens, nil
+}
+
+// rotationLostError explains why a token that was active when this request
+// read it could no longer be rotated. The token was not reused: either a
+// concurrent refresh rotated it, and the caller may retry, or it was revoked,
+// evicted or expired in the meantime.
+func (s *AuthServiceImpl) rotationLostError(refreshTokenID uuid.UUID) error {
+	current, err := s.refreshTokenRepository.GetByIDWithDeactivated(refreshTokenID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", serviceIntf.ErrRefreshTokenNotFound, err)
 	}
-	if err := s.refreshTokenRepository.Create(newRefreshToken); err != nil {
-		return "", "", fmt.Errorf("failed to save new refresh token: %w", err)
+	if current.RotatedAt != nil {
+		return serviceIntf.ErrRefreshConflict
 	}
+	return serviceIntf.ErrRefreshTokenNotFound
+}
+
+// clientScopes returns the scopes a sign-in by the client of request may be
+// granted: those listed for it in OAUTH_CLIENT_SCOPES once it authenticated,
+// PUBLIC_CLIENT_SCOPES otherwise. Requested scopes outside them are dropped.
+func clientScopes(request serviceIntf.TokenRequest) []string {
+	cfg := config.Load()
+	if request.ClientAuthenticated {
+		return cfg.ClientScopes[request.ClientID]
+	}
+	return cfg.PublicClientScopes
+}
+
+// sessionExpiry returns the absolute end of a session started at now, or nil
+// when SESSION_MAX_LIFETIME is disabled. Rotation copies it to every child,
+// so refreshing never extends a session.
+func sessionExpiry(now time.Time) *time.Time {
+	lifetime := config.Load().SessionLifetime
+	if lifetime <= 0 {
+		return nil
+	}
+	expiresAt := now.Add(lifetime)
+	return &expiresAt
+}
 
-	return newAccessToken, newRawRefreshToken, nil
+// refreshTokenExpiry returns when a refresh token issued at now expires: after
+// REFRESH_TOKEN_TTL, or SESSION_IDLE_TIMEOUT if shorter, and never later than
+// the end of its session.
+func refreshTokenExpiry(now time.Time, sessionExpiresAt *time.Time) *time.Time {
+	cfg := config.Load()
+	expiresAt := now.Add(cfg.RefreshTokenTTL)
+	if cfg.SessionIdle > 0 && cfg.SessionIdle < cfg.RefreshTokenTTL {
+		expiresAt = now.Add(cfg.SessionIdle)
+	}
+	if sessionExpiresAt != nil && sessionExpiresAt.Before(expiresAt) {
+		expiresAt = *sessionExpiresAt
+	}
+	return &expiresAt
 }
 
+// handleRefreshTokenReuse is called when an already rotated refresh token is
+// presented again. Either the legitimate client or an attacker holds a copy
+// of it, and there is no way to tell which, so the whole family is revoked.
+func (s *AuthServiceImpl) handleRefreshTokenReuse(refreshTokenModel *model.RefreshToken, userAgent, ip string) error {
+	familyID := refreshTokenModel.Family()
+	if err := s.refreshTokenRepository.MarkFamilyAsDeactivated(familyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	go func() {
+		details := map[string]interface{}{
+			"family_id":        familyID.String(),
+			"refresh_token_id": refreshTokenModel.ID.String(),
+			"ip":               ip,
+			"user_agent":       userAgent,
+		}
+		if err := utils.SendEventToWebhook(utils.EventTokenReuseDetected, refreshTokenModel.UserID, details); err != nil {
+			log.Printf("failed to send webhook event: %v", err)
+		}
+	}()
+
+	return serviceIntf.ErrRefreshTokenReused
+}
+
+// checkUser consults the user directory before tokens are issued or
+// accepted. A user who is no longer active loses every session. So does a
+// user who disappeared from the directory while holding sessions; without
+// hasSessions, as on sign-in, an unknown user is only rejected, so requests
+// naming arbitrary IDs cause no writes.
+func (s *AuthServiceImpl) checkUser(userID uuid.UUID, hasSessions bool) error {
+	user, err := s.userDirectory.User(userID)
+	switch {
+	case errors.Is(err, providerIntf.ErrUserNotFound):
+		if hasSessions {
+			if err := s.DeauthorizeUser(userID); err != nil {
+				return err
+			}
+			log.Printf("User %s is not in the user directory. All sessions revoked", userID)
+		}
+		return serviceIntf.ErrUserNotFound
+	case err != nil:
+		return fmt.Errorf("failed to look up user: %w", err)
+	case !user.IsActive():
+		if err := s.DeauthorizeUser(userID); err != nil {
+			return err
+		}
+		log.Printf("User %s is %s. All sessions revoked", userID, user.Status)
+		return serviceIntf.ErrUserDisabled
+	}
+	return nil
+}
+
+// checkSessionUsers runs checkUser for the user of the session and, if the
+// session is impersonated, for the actor.
+func (s *AuthServiceImpl) checkSessionUsers(session *model.RefreshToken) error {
+	if err := s.checkUser(session.UserID, true); err != nil {
+		return err
+	}
+	if session.ActorID != nil {
+		return s.checkUser(*session.ActorID, true)
+	}
+	return nil
+}
+
+// DeauthorizeUser ends every session of the user, including the sessions
+// the user opened as someone else through impersonation.
 func (s *AuthServiceImpl) DeauthorizeUser(userID uuid.UUID) error {
-	if err := s.refreshTokenRepository.MarkAllAsDeactivatedByUserID(userID); err != nil {
+	err := s.refreshTokenRepository.WithTransaction(func(repo repoIntf.RefreshTokenRepository) error {
+		if err := repo.MarkAllAsDeactivatedByUserID(userID); err != nil {
+			return err
+		}
+		return repo.MarkAllAsDeactivatedByActorID(userID)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to deauthorize user: %w", err)
 	}
 	return nil
@@ -131,6 +583,120 @@ func (s *AuthServiceImpl) GetUserIDByRefreshTokenID(refreshTokenID uuid.UUID) (u
 	return refreshTokenModel.UserID, nil
 }
 
+// IsTokenValid reports whether an access token of the session may still be
+// used: the session is active and its user, and the actor of an
+// impersonated session, are active in the user directory. A user found
+// disabled here loses every session at once instead of on the next refresh.
 func (s *AuthServiceImpl) IsTokenValid(refreshTokenID uuid.UUID) (bool, error) {
-	return s.refreshTokenRepository.IsTokenActive(refreshTokenID)
+	session, err := s.activeSession(refreshTokenID)
+	if errors.Is(err, serviceIntf.ErrRefreshTokenNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = s.checkSessionUsers(session)
+	if errors.Is(err, serviceIntf.ErrUserNotFound) || errors.Is(err, serviceIntf.ErrUserDisabled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetSession returns the refresh token row behind refreshTokenID whether or
+// not it is still active.
+func (s *AuthServiceImpl) GetSession(refreshTokenID uuid.UUID) (*model.RefreshToken, error) {
+	refreshTokenModel, err := s.refreshTokenRepository.GetByIDWithDeactivated(refreshTokenID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", serviceIntf.ErrRefreshTokenNotFound, err)
+	}
+	return refreshTokenModel, nil
+}
+
+// InspectRefreshToken looks up a self-contained refresh token and checks its
+// secret without rotating it. It reports whether the token could still be
+// exchanged.
+func (s *AuthServiceImpl) InspectRefreshToken(rawRefreshToken string) (*model.RefreshToken, bool, error) {
+	refreshTokenID, secret := utils.SplitRefreshToken(rawRefreshToken)
+	if refreshTokenID == uuid.Nil {
+		return nil, false, serviceIntf.ErrRefreshTokenIDMissing
+	}
+
+	refreshTokenModel, err := s.GetSession(refreshTokenID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !utils.VerifyRefreshToken(refreshTokenModel.TokenHash, secret) {
+		return nil, false, serviceIntf.ErrInvalidRefreshToken
+	}
+
+	active := refreshTokenModel.DeactivatedAt == nil &&
+		!refreshTokenModel.IsExpired(time.Now(), config.Load().RefreshTokenTTL)
+	return refreshTokenModel, active, nil
+}
+
+// ListSessions returns the active sessions of the user owning refreshTokenID.
+// Each session is represented by the latest refresh token of its family.
+func (s *AuthServiceImpl) ListSessions(refreshTokenID uuid.UUID) ([]model.RefreshToken, error) {
+	userID, err := s.GetUserIDByRefreshTokenID(refreshTokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.refreshTokenRepository.ListActiveByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one session of the user owning refreshTokenID. The
+// session is identified by its family ID, which survives rotation.
+func (s *AuthServiceImpl) RevokeSession(refreshTokenID, sessionID uuid.UUID) error {
+	userID, err := s.GetUserIDByRefreshTokenID(refreshTokenID)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.refreshTokenRepository.MarkFamilyAsDeactivatedByUserID(userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if !revoked {
+		return serviceIntf.ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSessionByTokenID ends the session refreshTokenID belongs to, whether
+// refreshTokenID is its latest refresh token or an already rotated one.
+func (s *AuthServiceImpl) RevokeSessionByTokenID(refreshTokenID uuid.UUID) error {
+	refreshTokenModel, err := s.GetSession(refreshTokenID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepository.MarkFamilyAsDeactivated(refreshTokenModel.Family()); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the user except the one
+// refreshTokenID belongs to.
+func (s *AuthServiceImpl) RevokeOtherSessions(refreshTokenID uuid.UUID) error {
+	refreshTokenModel, err := s.refreshTokenRepository.GetByID(refreshTokenID)
+	if err != nil {
+		return fmt.Errorf("refresh token not found: %w", err)
+	}
+
+	err = s.refreshTokenRepository.MarkAllAsDeactivatedByUserIDExceptFamily(refreshTokenModel.UserID, refreshTokenModel.Family())
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,747 @@
+package impl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/model"
+	provider "medods_test_task/internal/provider/impl"
+	providerIntf "medods_test_task/internal/provider/intf"
+	serviceIntf "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/signing"
+	tokenFormat "medods_test_task/internal/tokenformat/impl"
+	"medods_test_task/internal/utils"
+)
+
+func newTestAuthService(t *testing.T, repo *memoryRefreshTokenRepository) serviceIntf.AuthService {
+	t.Helper()
+	return newTestAuthServiceWithUsers(t, repo, provider.NewEmptyUserDirectory())
+}
+
+func newTestAuthServiceWithUsers(t *testing.T, repo *memoryRefreshTokenRepository, users providerIntf.UserDirectory) serviceIntf.AuthService {
+	t.Helper()
+	return newTestAuthServiceWithProviders(t, repo, provider.NewEmptyRoleProvider(), users)
+}
+
+func newTestAuthServiceWithProviders(t *testing.T, repo *memoryRefreshTokenRepository, roles providerIntf.RoleProvider, users providerIntf.UserDirectory) serviceIntf.AuthService {
+	t.Helper()
+	keyring := newTestKeyring(t)
+	return NewAuthService(repo, keyring, tokenFormat.NewJWTTokenFormat(keyring),
+		roles, provider.NewEmptyClaimsEnricher(), users)
+}
+
+func newTestKeyring(t *testing.T) *signing.Keyring {
+	t.Helper()
+	key, err := signing.NewSymmetricKey([]byte("test-secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signing.NewStaticKeyring(key)
+}
+
+// parseTestAccessToken reads an access token issued by a test auth service.
+func parseTestAccessToken(t *testing.T, token string) *utils.AccessTokenClaims {
+	t.Helper()
+	claims, err := tokenFormat.NewJWTTokenFormat(newTestKeyring(t)).Parse(token, true)
+	if err != nil {
+		t.Fatalf("access token does not parse: %v", err)
+	}
+	return claims
+}
+
+// withConfig changes the loaded configuration for the rest of the test.
+func withConfig(t *testing.T, change func(cfg *config.Config)) {
+	t.Helper()
+	cfg := config.Load()
+	saved := *cfg
+	change(cfg)
+	t.Cleanup(func() { *cfg = saved })
+}
+
+// recordWebhook points WEBHOOK at a test server and returns the events it
+// receives.
+func recordWebhook(t *testing.T) <-chan map[string]interface{} {
+	t.Helper()
+	events := make(chan map[string]interface{}, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			events <- event
+		}
+	}))
+	t.Cleanup(server.Close)
+	withConfig(t, func(cfg *config.Config) { cfg.WebHook = server.URL })
+	return events
+}
+
+// waitForEvent returns the next webhook event of the given type, skipping
+// others.
+func waitForEvent(t *testing.T, events <-chan map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event["event"] == name {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %s event was sent", name)
+			return nil
+		}
+	}
+}
+
+func createTokens(t *testing.T, service serviceIntf.AuthService, userID uuid.UUID) *serviceIntf.Tokens {
+	t.Helper()
+	tokens, err := service.CreateTokens(serviceIntf.TokenRequest{UserID: userID, UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func refresh(service serviceIntf.AuthService, refreshToken string) (*serviceIntf.Tokens, error) {
+	return service.UpdateTokens(serviceIntf.RefreshRequest{RefreshToken: refreshToken, UserAgent: "test", IP: "127.0.0.1"})
+}
+
+func refreshTokenID(refreshToken string) uuid.UUID {
+	id, _ := utils.SplitRefreshToken(refreshToken)
+	return id
+}
+
+// userRoles is a role provider with fixed roles.
+type userRoles map[uuid.UUID][]string
+
+func (r userRoles) Roles(userID uuid.UUID) ([]string, error) {
+	return r[userID], nil
+}
+
+// fixedClaims is a claims enricher returning the same claims for everyone.
+type fixedClaims map[string]interface{}
+
+func (c fixedClaims) Enrich(providerIntf.ClaimsRequest) (map[string]interface{}, error) {
+	return c, nil
+}
+
+// userStatuses is a user directory whose statuses tests can change.
+type userStatuses map[uuid.UUID]string
+
+func (u userStatuses) User(userID uuid.UUID) (*providerIntf.User, error) {
+	status, ok := u[userID]
+	if !ok {
+		return nil, providerIntf.ErrUserNotFound
+	}
+	return &providerIntf.User{ID: userID, Status: status}, nil
+}
+
+func TestUpdateTokensReplacesLegacyBcryptHash(t *testing.T) {
+	repo := newMemoryRefreshTokenRepository()
+	service := newTestAuthService(t, repo)
+
+	secret, err := utils.GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := &model.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    uuid.New(),
+		TokenHash: string(legacyHash),
+		UserAgent: "test",
+		IP:        "127.0.0.1",
+		CreatedAt: time.Now(),
+	}
+	if err := repo.Create(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := service.UpdateTokens(serviceIntf.RefreshRequest{
+		RefreshToken: utils.FormatRefreshToken(legacy.ID, secret),
+		UserAgent:    "test",
+		IP:           "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("legacy bcrypt refresh token was rejected: %v", err)
+	}
+
+	successorID, successorSecret := utils.SplitRefreshToken(tokens.RefreshToken)
+	successor, err := repo.GetByID(successorID)
+	if err != nil {
+		t.Fatalf("successor was not stored: %v", err)
+	}
+	if *successor.ParentID != legacy.ID {
+		t.Errorf("successor parent = %s, want %s", *successor.ParentID, legacy.ID)
+	}
+	if !strings.HasPrefix(successor.TokenHash, "hmac-sha256$") {
+		t.Errorf("successor hash %q is not HMAC", successor.TokenHash)
+	}
+	if !utils.VerifyRefreshToken(successor.TokenHash, successorSecret) {
+		t.Error("successor hash does not verify its secret")
+	}
+}
+
+func TestUpdateTokensRequiresIssuingClient(t *testing.T) {
+	service := newTestAuthService(t, newMemoryRefreshTokenRepository())
+	tokens, err := service.CreateTokens(serviceIntf.TokenRequest{
+		UserID:    uuid.New(),
+		UserAgent: "test",
+		IP:        "127.0.0.1",
+		ClientID:  "backend",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, clientID := range []string{"", "other"} {
+		_, err := service.UpdateTokens(serviceIntf.RefreshRequest{
+			RefreshToken: tokens.RefreshToken,
+			UserAgent:    "test",
+			IP:           "127.0.0.1",
+			ClientID:     clientID,
+		})
+		if !errors.Is(err, serviceIntf.ErrClientMismatch) {
+			t.Errorf("client %q: err = %v, want %v", clientID, err, serviceIntf.ErrClientMismatch)
+		}
+	}
+
+	_, err = service.UpdateTokens(serviceIntf.RefreshRequest{
+		RefreshToken: tokens.RefreshToken,
+		UserAgent:    "test",
+		IP:           "127.0.0.1",
+		ClientID:     "backend",
+	})
+	if err != nil {
+		t.Errorf("issuing client was rejected: %v", err)
+	}
+}
+
+func TestCreateTokensOmitsIDTokenUnderHS512(t *testing.T) {
+	service := newTestAuthService(t, newMemoryRefreshTokenRepository())
+	tokens, err := service.CreateTokens(serviceIntf.TokenRequest{
+		UserID:    uuid.New(),
+		UserAgent: "test",
+		IP:        "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.IDToken != "" {
+		t.Error("id_token was signed with the HS512 server secret")
+	}
+}
+
+func TestCreateTokensGrantsOnlyAllowedScopes(t *testing.T) {
+	requested := []string{"profile", "records:read", "records:write"}
+	tests := []struct {
+		name          string
+		clientID      string
+		authenticated bool
+		want          []string
+	}{
+		{"public client", "web", false, []string{"profile", "records:read"}},
+		{"authenticated client", "backend", true, []string{"profile", "records:read", "records:write"}},
+		{"unauthenticated confidential client", "backend", false, []string{"profile", "records:read"}},
+		{"authenticated client without scopes", "reports", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRefreshTokenRepository()
+			service := newTestAuthService(t, repo)
+			tokens, err := service.CreateTokens(serviceIntf.TokenRequest{
+				UserID:              uuid.New(),
+				UserAgent:           "test",
+				IP:                  "127.0.0.1",
+				ClientID:            tt.clientID,
+				ClientAuthenticated: tt.authenticated,
+				Scopes:              requested,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := parseTestAccessToken(t, tokens.AccessToken)
+			if !reflect.DeepEqual(tokens.Scopes, tt.want) || !reflect.DeepEqual(claims.Scopes(), tt.want) {
+				t.Errorf("granted %v, scope claim %v; want %v", tokens.Scopes, claims.Scopes(), tt.want)
+			}
+			session, err := repo.GetByID(claims.RefreshTokenID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.Scope != utils.FormatScope(tt.want) {
+				t.Errorf("session scope = %q, want %q", session.Scope, utils.FormatScope(tt.want))
+			}
+		})
+	}
+}
+
+func TestCreateTokensDropsReservedEnrichedClaims(t *testing.T) {
+	userID := uuid.New()
+	keyring := newTestKeyring(t)
+	enricher := fixedClaims{
+		"tenant":           "acme",
+		"sub":              uuid.NewString(),
+		"exp":              time.Now().Add(24 * time.Hour).Unix(),
+		"scope":            "records:write",
+		"roles":            []string{"admin"},
+		"refresh_token_id": uuid.NewString(),
+		"cnf":              map[string]string{"jkt": "attacker"},
+		"act":              map[string]string{"sub": "attacker"},
+	}
+	service := NewAuthService(newMemoryRefreshTokenRepository(), keyring, tokenFormat.NewJWTTokenFormat(keyring),
+		userRoles{userID: {"doctor"}}, enricher, provider.NewEmptyUserDirectory())
+
+	tokens, err := service.CreateTokens(serviceIntf.TokenRequest{
+		UserID:    userID,
+		UserAgent: "test",
+		IP:        "127.0.0.1",
+		ClientID:  "web",
+		Scopes:    []string{"profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Extra claims are not read back when parsing, so look at the payload.
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(tokens.AccessToken, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	parsed := parseTestAccessToken(t, tokens.AccessToken)
+
+	if claims["tenant"] != "acme" {
+		t.Errorf("tenant = %v, want the enriched claim", claims["tenant"])
+	}
+	if claims["sub"] != userID.String() || claims["scope"] != "profile" {
+		t.Errorf("sub = %v, scope = %v; want the ones issued by the service", claims["sub"], claims["scope"])
+	}
+	if !reflect.DeepEqual(parsed.Roles, []string{"doctor"}) || parsed.RefreshTokenID != refreshTokenID(tokens.RefreshToken) {
+		t.Errorf("roles = %v, refresh_token_id = %s; want the ones issued by the service", parsed.Roles, parsed.RefreshTokenID)
+	}
+	if parsed.ExpiresAt.After(time.Now().Add(config.Load().AccessTokenTTL)) {
+		t.Errorf("exp = %v, want the access token TTL", parsed.ExpiresAt)
+	}
+	for _, name := range []string{"cnf", "act"} {
+		if _, ok := claims[name]; ok {
+			t.Errorf("%s = %v, want it absent from an unbound token", name, claims[name])
+		}
+	}
+}
+
+func TestUnsavedSessionsLeaveNoReferenceTokens(t *testing.T) {
+	repo := newMemoryRefreshTokenRepository()
+	accessTokens := newMemoryAccessTokenRepository()
+	service := NewAuthService(repo, newTestKeyring(t), tokenFormat.NewReferenceTokenFormat(accessTokens, time.Hour),
+		provider.NewEmptyRoleProvider(), provider.NewEmptyClaimsEnricher(), provider.NewEmptyUserDirectory())
+
+	tokens, err := service.CreateTokens(serviceIntf.TokenRequest{UserID: uuid.New(), UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accessTokens.tokens) != 1 {
+		t.Fatalf("%d reference tokens stored after a sign-in, want 1", len(accessTokens.tokens))
+	}
+
+	repo.createErr = errors.New("database is down")
+	if _, err := service.CreateTokens(serviceIntf.TokenRequest{UserID: uuid.New(), UserAgent: "test", IP: "127.0.0.1"}); err == nil {
+		t.Fatal("sign-in succeeded without saving the session")
+	}
+	if _, err := service.UpdateTokens(serviceIntf.RefreshRequest{RefreshToken: tokens.RefreshToken, UserAgent: "test", IP: "127.0.0.1"}); err == nil {
+		t.Fatal("refresh succeeded without saving the new refresh token")
+	}
+	if len(accessTokens.tokens) != 1 {
+		t.Errorf("%d reference tokens stored, want only the one of the saved session", len(accessTokens.tokens))
+	}
+}
+
+func TestCreateTokensRejectsUnknownUserWithoutWrites(t *testing.T) {
+	repo := newMemoryRefreshTokenRepository()
+	service := newTestAuthServiceWithUsers(t, repo, userStatuses{})
+
+	_, err := service.CreateTokens(serviceIntf.TokenRequest{
+		UserID:    uuid.New(),
+		UserAgent: "test",
+		IP:        "127.0.0.1",
+	})
+	if !errors.Is(err, serviceIntf.ErrUserNotFound) {
+		t.Fatalf("err = %v, want %v", err, serviceIntf.ErrUserNotFound)
+	}
+	if repo.bulkDeactivations != 0 || len(repo.tokens) != 0 {
+		t.Errorf("rejected sign-in wrote to the repository: %d deactivations, %d tokens", repo.bulkDeactivations, len(repo.tokens))
+	}
+}
+
+func TestIsTokenValidRevokesDisabledUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		disable func(users userStatuses, userID, actorID uuid.UUID)
+	}{
+		{"user disabled", func(users userStatuses, userID, _ uuid.UUID) {
+			users[userID] = providerIntf.UserStatusDisabled
+		}},
+		{"user removed", func(users userStatuses, userID, _ uuid.UUID) {
+			delete(users, userID)
+		}},
+		{"actor blocked", func(users userStatuses, _, actorID uuid.UUID) {
+			users[actorID] = providerIntf.UserStatusBlocked
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRefreshTokenRepository()
+			userID, actorID := uuid.New(), uuid.New()
+			users := userStatuses{userID: providerIntf.UserStatusActive, actorID: providerIntf.UserStatusActive}
+			service := newTestAuthServiceWithUsers(t, repo, users)
+
+			now := time.Now()
+			session := &model.RefreshToken{
+				ID:        uuid.New(),
+				UserID:    userID,
+				ActorID:   &actorID,
+				TokenHash: utils.HashRefreshToken("secret"),
+				CreatedAt: now,
+			}
+			if err := repo.Create(session); err != nil {
+				t.Fatal(err)
+			}
+
+			if valid, err := service.IsTokenValid(session.ID); err != nil || !valid {
+				t.Fatalf("IsTokenValid = %v, %v before the change, want true", valid, err)
+			}
+			tt.disable(users, userID, actorID)
+			if valid, err := service.IsTokenValid(session.ID); err != nil || valid {
+				t.Fatalf("IsTokenValid = %v, %v after the change, want false", valid, err)
+			}
+			if stored, _ := repo.GetByIDWithDeactivated(session.ID); stored.DeactivatedAt == nil {
+				t.Error("session was not revoked")
+			}
+		})
+	}
+}
+
+func TestReusedRefreshTokenRevokesFamily(t *testing.T) {
+	withConfig(t, func(cfg *config.Config) { cfg.RefreshGracePeriod = 0 })
+	events := recordWebhook(t)
+	repo := newMemoryRefreshTokenRepository()
+	service := newTestAuthService(t, repo)
+	userID := uuid.New()
+
+	first := createTokens(t, service, userID)
+	other := createTokens(t, service, userID)
+	second, err := refresh(service, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := refresh(service, second.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := refresh(service, first.RefreshToken); !errors.Is(err, serviceIntf.ErrRefreshTokenReused) {
+		t.Fatalf("reusing a rotated token: err = %v, want %v", err, serviceIntf.ErrRefreshTokenReused)
+	}
+	event := waitForEvent(t, events, utils.EventTokenReuseDetected)
+	if event["family_id"] != refreshTokenID(first.RefreshToken).String() || event["user_id"] != userID.String() {
+		t.Errorf("reuse event = %v, want family %s of user %s", event, refreshTokenID(first.RefreshToken), userID)
+	}
+
+	if _, err := refresh(service, third.RefreshToken); !errors.Is(err, serviceIntf.ErrRefreshTokenNotFound) {
+		t.Errorf("the latest token of the family: err = %v, want %v", err, serviceIntf.ErrRefreshTokenNotFound)
+	}
+	if valid, _ := service.IsTokenValid(refreshTokenID(third.RefreshToken)); valid {
+		t.Error("access tokens of the revoked family are still valid")
+	}
+	if _, err := refresh(service, other.RefreshToken); err != nil {
+		t.Errorf("another session of the user was revoked: %v", err)
+	}
+}
+
+func TestExpiredRefreshTokens(t *testing.T) {
+	withConfig(t, func(cfg *config.Config) {
+		cfg.RefreshTokenTTL = 24 * time.Hour
+		cfg.SessionIdle = time.Hour
+		cfg.SessionLifetime = 48 * time.Hour
+	})
+	past := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name   string
+		expire func(token *model.RefreshToken)
+	}{
+		{"TTL or idle timeout", func(token *model.RefreshToken) { token.ExpiresAt = &past }},
+		{"absolute lifetime", func(token *model.RefreshToken) { token.SessionExpiresAt = &past }},
+		{"TTL of a token without an expiry", func(token *model.RefreshToken) {
+			token.ExpiresAt = nil
+			token.SessionExpiresAt = nil
+			token.CreatedAt = time.Now().Add(-25 * time.Hour)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRefreshTokenRepository()
+			service := newTestAuthService(t, repo)
+			tokens := createTokens(t, service, uuid.New())
+			tokens, err := refresh(service, tokens.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := refreshTokenID(tokens.RefreshToken)
+
+			repo.update(id, tt.expire)
+			if _, err := refresh(service, tokens.RefreshToken); !errors.Is(err, serviceIntf.ErrRefreshTokenExpired) {
+				t.Fatalf("err = %v, want %v", err, serviceIntf.ErrRefreshTokenExpired)
+			}
+			if stored, _ := repo.GetByIDWithDeactivated(id); stored.DeactivatedAt == nil {
+				t.Error("the expired token was not deactivated")
+			}
+			if _, err := refresh(service, tokens.RefreshToken); !errors.Is(err, serviceIntf.ErrRefreshTokenNotFound) {
+				t.Errorf("presenting it again: err = %v, want %v", err, serviceIntf.ErrRefreshTokenNotFound)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	withConfig(t, func(cfg *config.Config) {
+		cfg.RefreshTokenTTL = 24 * time.Hour
+		cfg.SessionIdle = time.Hour
+		cfg.SessionLifetime = 48 * time.Hour
+	})
+	repo := newMemoryRefreshTokenRepository()
+	service := newTestAuthService(t, repo)
+
+	// A token lasts REFRESH_TOKEN_TTL, or SESSION_IDLE_TIMEOUT if shorter.
+	for _, idle := range []time.Duration{0, time.Hour} {
+		config.Load().SessionIdle = idle
+		want := 24 * time.Hour
+		if idle > 0 {
+			want = idle
+		}
+		start := time.Now()
+		token, _ := repo.GetByID(refreshTokenID(createTokens(t, service, uuid.New()).RefreshToken))
+		if lifetime := token.ExpiresAt.Sub(start); lifetime < want || lifetime > want+time.Second {
+			t.Errorf("SESSION_IDLE_TIMEOUT=%v: refresh token lasts %v, want %v", idle, lifetime, want)
+		}
+	}
+
+	tokens := createTokens(t, service, uuid.New())
+	first, _ := repo.GetByID(refreshTokenID(tokens.RefreshToken))
+
+	tokens, err := refresh(service, tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := repo.GetByID(refreshTokenID(tokens.RefreshToken))
+	if !second.ExpiresAt.After(*first.ExpiresAt) {
+		t.Error("a refresh did not extend the idle timeout")
+	}
+	if !second.SessionExpiresAt.Equal(*first.SessionExpiresAt) {
+		t.Errorf("a refresh moved the end of the session from %v to %v", first.SessionExpiresAt, second.SessionExpiresAt)
+	}
+
+	// Close to the end of the session a new token expires with it.
+	sessionEnd := time.Now().Add(time.Minute)
+	repo.update(second.ID, func(token *model.RefreshToken) { token.SessionExpiresAt = &sessionEnd })
+	tokens, err = refresh(service, tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, _ := repo.GetByID(refreshTokenID(tokens.RefreshToken))
+	if !third.ExpiresAt.Equal(sessionEnd) {
+		t.Errorf("refresh token expires at %v, want the end of the session %v", third.ExpiresAt, sessionEnd)
+	}
+}
+
+func TestSessionLimitEvictsOldestSession(t *testing.T) {
+	withConfig(t, func(cfg *config.Config) {
+		cfg.MaxSessionsPerUser = 2
+		cfg.SessionLimitPolicy = config.SessionLimitPolicyEvictOldest
+	})
+	events := recordWebhook(t)
+	service := newTestAuthService(t, newMemoryRefreshTokenRepository())
+	userID := uuid.New()
+
+	signIn := createTokens(t, service, userID)
+	// A refresh keeps the session, so it stays the oldest one.
+	oldest, err := refresh(service, signIn.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := createTokens(t, service, userID)
+	newest := createTokens(t, service, userID)
+
+	event := waitForEvent(t, events, utils.EventSessionEvicted)
+	sessionID, newestID := refreshTokenID(signIn.RefreshToken), refreshTokenID(newest.RefreshToken)
+	if event["user_id"] != userID.String() || event["session_id"] != sessionID.String() || event["new_session_id"] != newestID.String() {
+		t.Errorf("eviction event = %v, want session %s of user %s evicted by %s", event, sessionID, userID, newestID)
+	}
+	for name, tokens := range map[string]*serviceIntf.Tokens{"kept": kept, "newest": newest} {
+		if valid, _ := service.IsTokenValid(refreshTokenID(tokens.RefreshToken)); !valid {
+			t.Errorf("the %s session was evicted", name)
+		}
+	}
+	if valid, _ := service.IsTokenValid(refreshTokenID(oldest.RefreshToken)); valid {
+		t.Error("the oldest session is still active")
+	}
+	if _, err := refresh(service, oldest.RefreshToken); !errors.Is(err, serviceIntf.ErrRefreshTokenNotFound) {
+		t.Errorf("refreshing the evicted session: err = %v, want %v", err, serviceIntf.ErrRefreshTokenNotFound)
+	}
+}
+
+func TestSessionLimitRejectsNewSession(t *testing.T) {
+	withConfig(t, func(cfg *config.Config) {
+		cfg.MaxSessionsPerUser = 2
+		cfg.SessionLimitPolicy = config.SessionLimitPolicyReject
+	})
+	repo := newMemoryRefreshTokenRepository()
+	service := newTestAuthService(t, repo)
+	userID := uuid.New()
+
+	first := createTokens(t, service, userID)
+	second := createTokens(t, service, userID)
+	_, err := service.CreateTokens(serviceIntf.TokenRequest{UserID: userID, UserAgent: "test", IP: "127.0.0.1"})
+	if !errors.Is(err, serviceIntf.ErrSessionLimitReached) {
+		t.Fatalf("err = %v, want %v", err, serviceIntf.ErrSessionLimitReached)
+	}
+	if len(repo.tokens) != 2 {
+		t.Errorf("%d sessions stored, want 2", len(repo.tokens))
+	}
+	for _, tokens := range []*serviceIntf.Tokens{first, second} {
+		if valid, _ := service.IsTokenValid(refreshTokenID(tokens.RefreshToken)); !valid {
+			t.Error("an existing session was revoked")
+		}
+	}
+
+	// Another user is not affected by the limit.
+	createTokens(t, service, uuid.New())
+}
+
+func TestUpdateTokensLosingConcurrentRotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(token *model.RefreshToken)
+		want   error
+	}{
+		{"rotated by another instance", func(token *model.RefreshToken) {
+			now := time.Now()
+			token.DeactivatedAt, token.RotatedAt = &now, &now
+		}, serviceIntf.ErrRefreshConflict},
+		{"revoked meanwhile", func(token *model.RefreshToken) {
+			now := time.Now()
+			token.DeactivatedAt = &now
+		}, serviceIntf.ErrRefreshTokenNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRefreshTokenRepository()
+			service := newTestAuthService(t, repo)
+			tokens := createTokens(t, service, uuid.New())
+
+			repo.beforeRotate = func(token *model.RefreshToken) {
+				repo.beforeRotate = nil
+				repo.update(token.ID, tt.change)
+			}
+			if _, err := refresh(service, tokens.RefreshToken); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if len(repo.tokens) != 1 {
+				t.Errorf("%d tokens stored, want no successor of the lost rotation", len(repo.tokens))
+			}
+			// Losing is not reuse, so the family is left alone.
+			if repo.bulkDeactivations != 0 {
+				t.Error("the lost rotation revoked the family")
+			}
+		})
+	}
+}
+
+func TestConcurrentRefreshesRotateOnce(t *testing.T) {
+	withConfig(t, func(cfg *config.Config) { cfg.RefreshGracePeriod = time.Minute })
+	repo := newMemoryRefreshTokenRepository()
+	service := newTestAuthService(t, repo)
+	tokens := createTokens(t, service, uuid.New())
+
+	results := make([]*serviceIntf.Tokens, 8)
+	errs := make([]error, len(results))
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = refresh(service, tokens.RefreshToken)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("refresh %d: %v", i, err)
+		}
+		if results[i].RefreshToken != results[0].RefreshToken {
+			t.Fatal("concurrent refreshes got different token pairs")
+		}
+	}
+	if len(repo.tokens) != 2 {
+		t.Errorf("%d tokens stored, want the sign-in and one successor", len(repo.tokens))
+	}
+}
+
+func TestRefreshGracePeriod(t *testing.T) {
+	const grace = 100 * time.Millisecond
+	withConfig(t, func(cfg *config.Config) { cfg.RefreshGracePeriod = grace })
+	repo := newMemoryRefreshTokenRepository()
+	service := newTestAuthService(t, repo)
+	tokens := createTokens(t, service, uuid.New())
+
+	rotated, err := refresh(service, tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := refresh(service, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("replay within the grace period: %v", err)
+	}
+	if replayed.RefreshToken != rotated.RefreshToken || replayed.AccessToken != rotated.AccessToken {
+		t.Error("a replay within the grace period did not get the cached pair")
+	}
+	_, err = service.UpdateTokens(serviceIntf.RefreshRequest{RefreshToken: tokens.RefreshToken, UserAgent: "other", IP: "127.0.0.1"})
+	if !errors.Is(err, serviceIntf.ErrRefreshConflict) {
+		t.Errorf("replay from another user agent: err = %v, want %v", err, serviceIntf.ErrRefreshConflict)
+	}
+
+	// Another instance has no cached pair, but does not report reuse either.
+	other := newTestAuthService(t, repo)
+	if _, err := refresh(other, tokens.RefreshToken); !errors.Is(err, serviceIntf.ErrRefreshConflict) {
+		t.Errorf("replay on another instance: err = %v, want %v", err, serviceIntf.ErrRefreshConflict)
+	}
+	if repo.bulkDeactivations != 0 {
+		t.Fatal("a replay within the grace period revoked the family")
+	}
+
+	time.Sleep(grace)
+	if _, err := refresh(service, tokens.RefreshToken); !errors.Is(err, serviceIntf.ErrRefreshTokenReused) {
+		t.Fatalf("replay after the grace period: err = %v, want %v", err, serviceIntf.ErrRefreshTokenReused)
+	}
+	if valid, _ := service.IsTokenValid(refreshTokenID(rotated.RefreshToken)); valid {
+		t.Error("the family survived a replay after the grace period")
+	}
+}
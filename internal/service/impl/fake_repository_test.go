@@ -0,0 +1,233 @@
+package impl
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/repository/intf"
+)
+
+// memoryRefreshTokenRepository keeps refresh tokens in memory. Transactions
+// are not isolated, which is enough for tests that run requests one by one.
+type memoryRefreshTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]model.RefreshToken
+	// bulkDeactivations counts calls that deactivate sessions by user,
+	// actor or family, whether or not they matched any.
+	bulkDeactivations int
+	// createErr, if set, fails every Create.
+	createErr error
+	// beforeRotate, if set, runs at the start of MarkAsRotated, standing in
+	// for another instance that changes the token first.
+	beforeRotate func(token *model.RefreshToken)
+}
+
+func newMemoryRefreshTokenRepository() *memoryRefreshTokenRepository {
+	return &memoryRefreshTokenRepository{tokens: make(map[uuid.UUID]model.RefreshToken)}
+}
+
+func (r *memoryRefreshTokenRepository) WithTransaction(fn func(repo intf.RefreshTokenRepository) error) error {
+	return fn(r)
+}
+
+func (r *memoryRefreshTokenRepository) LockUserSessions(uuid.UUID) error {
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) Create(token *model.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.createErr != nil {
+		return r.createErr
+	}
+	r.tokens[token.ID] = *token
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) GetByID(refreshTokenID uuid.UUID) (*model.RefreshToken, error) {
+	token, err := r.GetByIDWithDeactivated(refreshTokenID)
+	if err != nil || token.DeactivatedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return token, nil
+}
+
+func (r *memoryRefreshTokenRepository) GetByIDWithDeactivated(refreshTokenID uuid.UUID) (*model.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[refreshTokenID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &token, nil
+}
+
+func (r *memoryRefreshTokenRepository) MarkAsDeactivated(token *model.RefreshToken) error {
+	now := time.Now()
+	token.DeactivatedAt = &now
+	return r.Create(token)
+}
+
+func (r *memoryRefreshTokenRepository) MarkAsRotated(token *model.RefreshToken) (bool, error) {
+	if r.beforeRotate != nil {
+		r.beforeRotate(token)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current := r.tokens[token.ID]; current.DeactivatedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.DeactivatedAt = &now
+	token.RotatedAt = &now
+	r.tokens[token.ID] = *token
+	return true, nil
+}
+
+func (r *memoryRefreshTokenRepository) deactivate(match func(token model.RefreshToken) bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bulkDeactivations++
+	now := time.Now()
+	count := 0
+	for id, token := range r.tokens {
+		if token.DeactivatedAt == nil && match(token) {
+			token.DeactivatedAt = &now
+			r.tokens[id] = token
+			count++
+		}
+	}
+	return count
+}
+
+func (r *memoryRefreshTokenRepository) MarkAllAsDeactivatedByUserID(userID uuid.UUID) error {
+	r.deactivate(func(token model.RefreshToken) bool { return token.UserID == userID })
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) MarkAllAsDeactivatedByActorID(actorID uuid.UUID) error {
+	r.deactivate(func(token model.RefreshToken) bool { return token.ActorID != nil && *token.ActorID == actorID })
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) MarkFamilyAsDeactivated(familyID uuid.UUID) error {
+	r.deactivate(func(token model.RefreshToken) bool { return token.Family() == familyID })
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) ListActiveByUserID(userID uuid.UUID) ([]model.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var tokens []model.RefreshToken
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.DeactivatedAt == nil &&
+			(token.ExpiresAt == nil || token.ExpiresAt.After(now)) &&
+			(token.SessionExpiresAt == nil || token.SessionExpiresAt.After(now)) {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (r *memoryRefreshTokenRepository) MarkFamilyAsDeactivatedByUserID(userID, familyID uuid.UUID) (bool, error) {
+	count := r.deactivate(func(token model.RefreshToken) bool {
+		return token.UserID == userID && token.Family() == familyID
+	})
+	return count > 0, nil
+}
+
+func (r *memoryRefreshTokenRepository) MarkAllAsDeactivatedByUserIDExceptFamily(userID, familyID uuid.UUID) error {
+	r.deactivate(func(token model.RefreshToken) bool {
+		return token.UserID == userID && token.Family() != familyID
+	})
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) CountActiveByUserID(userID uuid.UUID) (int64, error) {
+	tokens, _ := r.ListActiveByUserID(userID)
+	var count int64
+	for _, token := range tokens {
+		if token.ActorID == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryRefreshTokenRepository) EvictOldestActiveByUserID(userID uuid.UUID, count int) ([]model.RefreshToken, error) {
+	tokens, _ := r.ListActiveByUserID(userID)
+	var evicted []model.RefreshToken
+	for i := len(tokens) - 1; i >= 0 && len(evicted) < count; i-- {
+		if tokens[i].ActorID != nil {
+			continue
+		}
+		token := tokens[i]
+		if err := r.MarkAsDeactivated(&token); err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, token)
+	}
+	return evicted, nil
+}
+
+func (r *memoryRefreshTokenRepository) IsTokenActive(refreshTokenID uuid.UUID) (bool, error) {
+	token, err := r.GetByID(refreshTokenID)
+	if err != nil {
+		return false, nil
+	}
+	return token.SessionExpiresAt == nil || token.SessionExpiresAt.After(time.Now()), nil
+}
+
+// update changes a stored token, standing in for time passing.
+func (r *memoryRefreshTokenRepository) update(refreshTokenID uuid.UUID, change func(token *model.RefreshToken)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token := r.tokens[refreshTokenID]
+	change(&token)
+	r.tokens[refreshTokenID] = token
+}
+
+// memoryAccessTokenRepository keeps reference access tokens in memory.
+type memoryAccessTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]model.AccessToken
+}
+
+func newMemoryAccessTokenRepository() *memoryAccessTokenRepository {
+	return &memoryAccessTokenRepository{tokens: make(map[string]model.AccessToken)}
+}
+
+func (r *memoryAccessTokenRepository) Create(token *model.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (r *memoryAccessTokenRepository) GetByHash(tokenHash string) (*model.AccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &token, nil
+}
+
+func (r *memoryAccessTokenRepository) Delete(tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, tokenHash)
+	return nil
+}
+
+func (r *memoryAccessTokenRepository) DeleteExpiredBefore(time.Time) (int64, error) {
+	return 0, nil
+}
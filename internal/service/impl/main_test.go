@@ -0,0 +1,24 @@
+package impl
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	env := map[string]string{
+		"ACCESS_TOKEN_TTL":     "15m",
+		"JWT_SECRET":           "test-secret",
+		"DB_DSN":               "unused",
+		"WEBHOOK":              "http://127.0.0.1:1/",
+		"REFRESH_TOKEN_PEPPER": "test-pepper",
+		"REFRESH_GRACE_PERIOD": "1m",
+		"OAUTH_CLIENTS":        "backend:backend-secret,reports:reports-secret",
+		"OAUTH_CLIENT_SCOPES":  "backend:profile records:read records:write",
+		"PUBLIC_CLIENT_SCOPES": "profile,records:read",
+	}
+	for key, value := range env {
+		_ = os.Setenv(key, value)
+	}
+	os.Exit(m.Run())
+}
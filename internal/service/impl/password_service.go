@@ -0,0 +1,199 @@
+package impl
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/model"
+	repoIntf "medods_test_task/internal/repository/intf"
+	serviceIntf "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/utils"
+)
+
+// passwordHashWait is how long a password check waits for a free hashing
+// slot before it is refused.
+const passwordHashWait = 2 * time.Second
+
+type PasswordServiceImpl struct {
+	credentialRepository repoIntf.CredentialRepository
+	authService          serviceIntf.AuthService
+	hasher               *utils.PasswordHasher
+	// dummyHash is verified when the login is unknown, so that failure
+	// takes as long as a wrong password and does not reveal which logins
+	// exist.
+	dummyHash string
+	// hashSlots bounds the Argon2id computations running at once. Each of
+	// them holds PASSWORD_ARGON2_MEMORY and logins are unauthenticated, so
+	// without a bound a burst of attempts could exhaust memory and CPU.
+	hashSlots chan struct{}
+	hashWait  time.Duration
+}
+
+func NewPasswordService(credentialRepository repoIntf.CredentialRepository, authService serviceIntf.AuthService) (serviceIntf.PasswordService, error) {
+	hasher := utils.NewPasswordHasher(PasswordHashParams())
+	dummyHash, err := hasher.Hash(rand.Text())
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash dummy password: %w", err)
+	}
+
+	return &PasswordServiceImpl{
+		credentialRepository: credentialRepository,
+		authService:          authService,
+		hasher:               hasher,
+		dummyHash:            dummyHash,
+		hashSlots:            make(chan struct{}, max(config.Load().PasswordHashSlots, 1)),
+		hashWait:             passwordHashWait,
+	}, nil
+}
+
+// PasswordHashParams returns the configured Argon2id parameters.
+func PasswordHashParams() utils.Argon2Params {
+	cfg := config.Load()
+	return utils.Argon2Params{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+	}
+}
+
+// Login checks the password and opens a session through CreateTokens, so
+// the user directory, scopes and binding apply as for any other sign-in.
+// Hashes made with outdated parameters are replaced on success.
+func (s *PasswordServiceImpl) Login(request serviceIntf.LoginRequest) (*serviceIntf.Tokens, error) {
+	credential, err := s.credentialRepository.GetByLogin(utils.NormalizeLogin(request.Login))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	if err := s.verifyLoginPassword(credential, request.Password); err != nil {
+		return nil, err
+	}
+
+	tokenRequest := request.TokenRequest
+	tokenRequest.UserID = credential.UserID
+	return s.authService.CreateTokens(tokenRequest)
+}
+
+// ChangePassword replaces the password after checking the current one and
+// ends every other session of the user, so whoever knew the old password
+// is signed out. It is refused in impersonated sessions.
+func (s *PasswordServiceImpl) ChangePassword(request serviceIntf.PasswordChangeRequest) error {
+	session, err := s.authService.GetSession(request.RefreshTokenID)
+	if err != nil {
+		return err
+	}
+	if session.IsImpersonated() {
+		return serviceIntf.ErrImpersonatedSession
+	}
+
+	if utf8.RuneCountInString(request.NewPassword) < config.Load().PasswordMinLength {
+		return serviceIntf.ErrPasswordTooShort
+	}
+
+	credential, err := s.credentialRepository.GetByUserID(request.UserID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	newHash, err := s.replacePasswordHash(credential, request.CurrentPassword, request.NewPassword)
+	if err != nil {
+		return err
+	}
+	updated, err := s.credentialRepository.UpdatePasswordHash(credential, newHash)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if !updated {
+		// The password changed after it was checked, so the current
+		// password given here is no longer the current one.
+		return serviceIntf.ErrInvalidCredentials
+	}
+
+	if err := s.authService.RevokeOtherSessions(request.RefreshTokenID); err != nil {
+		return err
+	}
+	log.Printf("Password changed. User: %s. Other sessions revoked", request.UserID)
+	return nil
+}
+
+// verifyLoginPassword checks password against credential, or against the
+// dummy hash when the login is unknown, and replaces a hash made with
+// outdated parameters.
+func (s *PasswordServiceImpl) verifyLoginPassword(credential *model.Credential, password string) error {
+	release, err := s.acquireHashSlot()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	passwordHash := s.dummyHash
+	if credential != nil {
+		passwordHash = credential.PasswordHash
+	}
+	ok, needsRehash, err := s.hasher.Verify(passwordHash, password)
+	if err != nil {
+		return fmt.Errorf("failed to verify password: %w", err)
+	}
+	if credential == nil || !ok {
+		return serviceIntf.ErrInvalidCredentials
+	}
+
+	// The rehash is skipped if the password changed after it was verified,
+	// so that it cannot bring the old password back.
+	if needsRehash {
+		if newHash, err := s.hasher.Hash(password); err != nil {
+			log.Printf("failed to rehash password of user %s: %v", credential.UserID, err)
+		} else if _, err := s.credentialRepository.UpdatePasswordHash(credential, newHash); err != nil {
+			log.Printf("failed to store rehashed password of user %s: %v", credential.UserID, err)
+		}
+	}
+	return nil
+}
+
+// replacePasswordHash checks the current password and hashes the new one.
+func (s *PasswordServiceImpl) replacePasswordHash(credential *model.Credential, currentPassword, newPassword string) (string, error) {
+	release, err := s.acquireHashSlot()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	passwordHash := s.dummyHash
+	if credential != nil {
+		passwordHash = credential.PasswordHash
+	}
+	ok, _, err := s.hasher.Verify(passwordHash, currentPassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify password: %w", err)
+	}
+	if credential == nil || !ok {
+		return "", serviceIntf.ErrInvalidCredentials
+	}
+
+	newHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return newHash, nil
+}
+
+// acquireHashSlot takes one of the PASSWORD_HASH_CONCURRENCY hashing slots,
+// waiting at most hashWait for it, and returns the function releasing it.
+func (s *PasswordServiceImpl) acquireHashSlot() (func(), error) {
+	timer := time.NewTimer(s.hashWait)
+	defer timer.Stop()
+
+	select {
+	case s.hashSlots <- struct{}{}:
+		return func() { <-s.hashSlots }, nil
+	case <-timer.C:
+		return nil, serviceIntf.ErrPasswordCheckBusy
+	}
+}
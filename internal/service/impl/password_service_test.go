@@ -0,0 +1,191 @@
+package impl
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/model"
+	serviceIntf "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/utils"
+)
+
+// noCredentials is a credential repository without any logins.
+type noCredentials struct{}
+
+func (noCredentials) Save(*model.Credential) error { return nil }
+
+func (noCredentials) GetByLogin(string) (*model.Credential, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (noCredentials) GetByUserID(uuid.UUID) (*model.Credential, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (noCredentials) UpdatePasswordHash(*model.Credential, string) (bool, error) { return false, nil }
+
+// memoryCredentials is a credential repository of a single user. Its
+// UpdatePasswordHash is conditional like the real one, and calls
+// beforeUpdate first, once, so tests can interleave another change.
+type memoryCredentials struct {
+	mu           sync.Mutex
+	credential   model.Credential
+	beforeUpdate func()
+}
+
+func (r *memoryCredentials) Save(credential *model.Credential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.credential = *credential
+	return nil
+}
+
+func (r *memoryCredentials) GetByLogin(login string) (*model.Credential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.credential.Login != login {
+		return nil, gorm.ErrRecordNotFound
+	}
+	credential := r.credential
+	return &credential, nil
+}
+
+func (r *memoryCredentials) GetByUserID(userID uuid.UUID) (*model.Credential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.credential.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	credential := r.credential
+	return &credential, nil
+}
+
+func (r *memoryCredentials) UpdatePasswordHash(credential *model.Credential, passwordHash string) (bool, error) {
+	if hook := r.beforeUpdate; hook != nil {
+		r.beforeUpdate = nil
+		hook()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.credential.UserID != credential.UserID || r.credential.PasswordHash != credential.PasswordHash {
+		return false, nil
+	}
+	r.credential.PasswordHash = passwordHash
+	credential.PasswordHash = passwordHash
+	return true, nil
+}
+
+// signedInSession is an auth service for password tests: every session is
+// a plain one and signing in always succeeds.
+type signedInSession struct {
+	serviceIntf.AuthService
+}
+
+func (signedInSession) GetSession(refreshTokenID uuid.UUID) (*model.RefreshToken, error) {
+	return &model.RefreshToken{ID: refreshTokenID}, nil
+}
+
+func (signedInSession) RevokeOtherSessions(uuid.UUID) error { return nil }
+
+func (signedInSession) CreateTokens(serviceIntf.TokenRequest) (*serviceIntf.Tokens, error) {
+	return &serviceIntf.Tokens{}, nil
+}
+
+func TestLoginWaitsForHashSlot(t *testing.T) {
+	hasher := utils.NewPasswordHasher(utils.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})
+	dummyHash, err := hasher.Hash("dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &PasswordServiceImpl{
+		credentialRepository: noCredentials{},
+		hasher:               hasher,
+		dummyHash:            dummyHash,
+		hashSlots:            make(chan struct{}, 1),
+		hashWait:             10 * time.Millisecond,
+	}
+	login := serviceIntf.LoginRequest{Login: "alice", Password: "secret-password"}
+
+	release, err := service.acquireHashSlot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Login(login); !errors.Is(err, serviceIntf.ErrPasswordCheckBusy) {
+		t.Errorf("with every slot taken: err = %v, want %v", err, serviceIntf.ErrPasswordCheckBusy)
+	}
+
+	release()
+	if _, err := service.Login(login); !errors.Is(err, serviceIntf.ErrInvalidCredentials) {
+		t.Errorf("with a free slot: err = %v, want %v", err, serviceIntf.ErrInvalidCredentials)
+	}
+	if len(service.hashSlots) != 0 {
+		t.Error("Login did not release its hash slot")
+	}
+}
+
+func TestLoginRehashKeepsConcurrentPasswordChange(t *testing.T) {
+	weakHash, err := utils.NewPasswordHasher(utils.Argon2Params{Memory: 32, Iterations: 1, Parallelism: 1}).Hash("old-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := utils.NewPasswordHasher(utils.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})
+	userID := uuid.New()
+	repo := &memoryCredentials{credential: model.Credential{UserID: userID, Login: "alice", PasswordHash: weakHash}}
+	service := &PasswordServiceImpl{
+		credentialRepository: repo,
+		authService:          signedInSession{},
+		hasher:               hasher,
+		dummyHash:            weakHash,
+		hashSlots:            make(chan struct{}, 2),
+		hashWait:             time.Second,
+	}
+
+	// The password is changed after the login verified the old one and
+	// before it stores the rehashed old password.
+	var changeErr error
+	repo.beforeUpdate = func() {
+		changeErr = service.ChangePassword(serviceIntf.PasswordChangeRequest{
+			UserID:          userID,
+			RefreshTokenID:  uuid.New(),
+			CurrentPassword: "old-password",
+			NewPassword:     "new-password",
+		})
+	}
+	if _, err := service.Login(serviceIntf.LoginRequest{Login: "alice", Password: "old-password"}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if changeErr != nil {
+		t.Fatalf("ChangePassword: %v", changeErr)
+	}
+
+	stored, _ := repo.GetByUserID(userID)
+	if ok, _, _ := hasher.Verify(stored.PasswordHash, "new-password"); !ok {
+		t.Error("the login rehash overwrote the changed password")
+	}
+	if ok, _, _ := hasher.Verify(stored.PasswordHash, "old-password"); ok {
+		t.Error("the old password still works after the change")
+	}
+
+	// A change whose current password was replaced meanwhile is refused.
+	repo.beforeUpdate = func() {
+		credential, _ := repo.GetByUserID(userID)
+		if _, err := repo.UpdatePasswordHash(credential, weakHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = service.ChangePassword(serviceIntf.PasswordChangeRequest{
+		UserID:          userID,
+		RefreshTokenID:  uuid.New(),
+		CurrentPassword: "new-password",
+		NewPassword:     "third-password",
+	})
+	if !errors.Is(err, serviceIntf.ErrInvalidCredentials) {
+		t.Errorf("ChangePassword after a concurrent change: err = %v, want %v", err, serviceIntf.ErrInvalidCredentials)
+	}
+}
@@ -0,0 +1,94 @@
+package impl
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/service/intf"
+)
+
+// rotationResult is the token pair issued when a refresh token was rotated,
+// kept for the grace period so a parallel request presenting the same token
+// gets the same pair instead of tripping reuse detection.
+type rotationResult struct {
+	tokens    *intf.Tokens
+	userAgent string
+	expiresAt time.Time
+}
+
+// refreshGraceCache is local to the instance, so the same pair is only
+// returned by the instance that did the rotation. Elsewhere a token presented
+// within the grace period gets a retryable error instead of revoking its
+// family.
+type refreshGraceCache struct {
+	mu      sync.Mutex
+	results map[uuid.UUID]rotationResult
+}
+
+func newRefreshGraceCache() *refreshGraceCache {
+	return &refreshGraceCache{results: make(map[uuid.UUID]rotationResult)}
+}
+
+func (c *refreshGraceCache) store(rotatedTokenID uuid.UUID, result rotationResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, cached := range c.results {
+		if !now.Before(cached.expiresAt) {
+			delete(c.results, id)
+		}
+	}
+	c.results[rotatedTokenID] = result
+}
+
+func (c *refreshGraceCache) load(rotatedTokenID uuid.UUID) (rotationResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result, ok := c.results[rotatedTokenID]
+	if !ok || !time.Now().Before(result.expiresAt) {
+		return rotationResult{}, false
+	}
+	return result, true
+}
+
+// keyedMutex serialises refreshes of the same token within the instance so
+// the second request observes the result of the first one.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[uuid.UUID]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[uuid.UUID]*keyedLock)}
+}
+
+func (m *keyedMutex) lock(key uuid.UUID) (unlock func()) {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
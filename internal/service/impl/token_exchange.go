@@ -0,0 +1,172 @@
+package impl
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/model"
+	serviceIntf "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/utils"
+)
+
+// ExchangeToken issues a narrower access token for an existing session, as
+// a backend service does before calling another one on the user's behalf.
+// No new session is created: the token dies with the session it came from.
+// It is bound to the caller's DPoP key or certificate, not the user's.
+func (s *AuthServiceImpl) ExchangeToken(request serviceIntf.ExchangeRequest) (*serviceIntf.Tokens, error) {
+	refreshTokenModel, err := s.activeSession(request.RefreshTokenID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSessionUsers(refreshTokenModel); err != nil {
+		return nil, err
+	}
+
+	scopes := request.SubjectScopes
+	if request.Scopes != nil {
+		if !utils.ContainsScopes(request.SubjectScopes, request.Scopes) {
+			return nil, serviceIntf.ErrInvalidScope
+		}
+		scopes = request.Scopes
+	}
+
+	// The caller becomes the current actor. Whoever acted before, a client
+	// that exchanged the token earlier or the impersonating user, stays in
+	// the chain below it.
+	previous := request.SubjectAct
+	if previous == nil {
+		previous = sessionActor(refreshTokenModel)
+	}
+	act := &utils.Actor{ClientID: request.ClientID, Act: previous}
+	accessToken, err := s.issueAccessToken(refreshTokenModel, scopes, act, request.Binding)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Token exchanged. Client: %s. User: %s. Session: %s. Scope: %q",
+		request.ClientID, refreshTokenModel.UserID, refreshTokenModel.Family(), utils.FormatScope(scopes))
+
+	return &serviceIntf.Tokens{
+		AccessToken: accessToken,
+		Scopes:      scopes,
+		Binding:     request.Binding,
+	}, nil
+}
+
+// Impersonate opens a session of the subject for an actor holding
+// IMPERSONATION_ROLE. The session is marked with the actor, its tokens carry
+// an act claim, it does not count towards the subject's session limit and
+// it lasts at most IMPERSONATION_MAX_LIFETIME.
+func (s *AuthServiceImpl) Impersonate(request serviceIntf.ImpersonationRequest) (*serviceIntf.Tokens, error) {
+	cfg := config.Load()
+
+	actorSession, err := s.activeSession(request.ActorSessionID)
+	if err != nil {
+		return nil, err
+	}
+	if actorSession.UserID != request.ActorID || actorSession.IsImpersonated() || request.SubjectID == request.ActorID {
+		return nil, serviceIntf.ErrImpersonationForbidden
+	}
+
+	actorRoles, err := s.roleProvider.Roles(request.ActorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve actor roles: %w", err)
+	}
+	if !slices.Contains(actorRoles, cfg.ImpersonationRole) {
+		return nil, serviceIntf.ErrImpersonationForbidden
+	}
+
+	if err := s.checkUser(request.ActorID, true); err != nil {
+		return nil, err
+	}
+	if err := s.checkUser(request.SubjectID, false); err != nil {
+		return nil, err
+	}
+
+	scopes := request.ActorScopes
+	if request.Scopes != nil {
+		if !utils.ContainsScopes(request.ActorScopes, request.Scopes) {
+			return nil, serviceIntf.ErrInvalidScope
+		}
+		scopes = request.Scopes
+	}
+
+	rawRefreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	refreshTokenID := uuid.New()
+	now := time.Now()
+	sessionExpiresAt := now.Add(cfg.ImpersonationTTL)
+	if limit := sessionExpiry(now); limit != nil && limit.Before(sessionExpiresAt) {
+		sessionExpiresAt = *limit
+	}
+	refreshTokenModel := &model.RefreshToken{
+		ID:                 refreshTokenID,
+		UserID:             request.SubjectID,
+		FamilyID:           refreshTokenID,
+		ActorID:            &request.ActorID,
+		TokenHash:          utils.HashRefreshToken(rawRefreshToken),
+		UserAgent:          request.UserAgent,
+		IP:                 request.IP,
+		ClientID:           request.ClientID,
+		Scope:              utils.FormatScope(scopes),
+		ProofKeyThumbprint: request.Binding.JKT,
+		CertThumbprint:     request.Binding.X5T,
+		ExpiresAt:          refreshTokenExpiry(now, &sessionExpiresAt),
+		SessionExpiresAt:   &sessionExpiresAt,
+		AuthenticatedAt:    &now,
+		CreatedAt:          now,
+	}
+
+	tokens, err := s.issueTokens(refreshTokenModel, rawRefreshToken, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.refreshTokenRepository.Create(refreshTokenModel); err != nil {
+		s.discardAccessToken(tokens.AccessToken)
+		return nil, fmt.Errorf("failed to save refresh token to database: %w", err)
+	}
+
+	s.notifyImpersonation(refreshTokenModel)
+	return tokens, nil
+}
+
+// activeSession returns the refresh token behind refreshTokenID if its
+// session is still active.
+func (s *AuthServiceImpl) activeSession(refreshTokenID uuid.UUID) (*model.RefreshToken, error) {
+	isActive, err := s.refreshTokenRepository.IsTokenActive(refreshTokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session: %w", err)
+	}
+	if !isActive {
+		return nil, serviceIntf.ErrRefreshTokenNotFound
+	}
+	return s.GetSession(refreshTokenID)
+}
+
+func (s *AuthServiceImpl) notifyImpersonation(session *model.RefreshToken) {
+	log.Printf("Impersonation started. Actor: %s. User: %s. Session: %s. IP: %s",
+		session.ActorID, session.UserID, session.Family(), session.IP)
+
+	go func() {
+		details := map[string]interface{}{
+			"actor_id":   session.ActorID.String(),
+			"session_id": session.Family().String(),
+			"client_id":  session.ClientID,
+			"scope":      session.Scope,
+			"ip":         session.IP,
+			"user_agent": session.UserAgent,
+		}
+		if err := utils.SendEventToWebhook(utils.EventImpersonation, session.UserID, details); err != nil {
+			log.Printf("failed to send webhook event: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,226 @@
+package impl
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/model"
+	provider "medods_test_task/internal/provider/impl"
+	providerIntf "medods_test_task/internal/provider/intf"
+	serviceIntf "medods_test_task/internal/service/intf"
+	"medods_test_task/internal/utils"
+)
+
+func signIn(t *testing.T, service serviceIntf.AuthService, userID uuid.UUID, scopes []string) *utils.AccessTokenClaims {
+	t.Helper()
+	tokens, err := service.CreateTokens(serviceIntf.TokenRequest{
+		UserID:    userID,
+		UserAgent: "test",
+		IP:        "127.0.0.1",
+		Scopes:    scopes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseTestAccessToken(t, tokens.AccessToken)
+}
+
+func exchange(t *testing.T, service serviceIntf.AuthService, subject *utils.AccessTokenClaims, clientID string, scopes []string) (*utils.AccessTokenClaims, error) {
+	t.Helper()
+	tokens, err := service.ExchangeToken(serviceIntf.ExchangeRequest{
+		RefreshTokenID: subject.RefreshTokenID,
+		SubjectScopes:  subject.Scopes(),
+		SubjectAct:     subject.Act,
+		Scopes:         scopes,
+		ClientID:       clientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseTestAccessToken(t, tokens.AccessToken), nil
+}
+
+func TestExchangeTokenKeepsActorChain(t *testing.T) {
+	service := newTestAuthService(t, newMemoryRefreshTokenRepository())
+	userID := uuid.New()
+	subject := signIn(t, service, userID, []string{"profile", "records:read"})
+
+	first, err := exchange(t, service, subject, "backend", []string{"records:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Subject != userID.String() || first.RefreshTokenID != subject.RefreshTokenID {
+		t.Errorf("exchanged token is of %s, session %s; want %s, session %s", first.Subject, first.RefreshTokenID, userID, subject.RefreshTokenID)
+	}
+	if want := (&utils.Actor{ClientID: "backend"}); !reflect.DeepEqual(first.Act, want) {
+		t.Errorf("act = %+v, want %+v", first.Act, want)
+	}
+
+	second, err := exchange(t, service, first, "reports", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &utils.Actor{ClientID: "reports", Act: &utils.Actor{ClientID: "backend"}}
+	if !reflect.DeepEqual(second.Act, want) {
+		t.Errorf("act of a second exchange = %+v, want %+v", second.Act, want)
+	}
+	if !reflect.DeepEqual(second.Scopes(), []string{"records:read"}) {
+		t.Errorf("scope of a second exchange = %v, want the narrowed one", second.Scopes())
+	}
+
+	if _, err := exchange(t, service, first, "reports", []string{"profile"}); !errors.Is(err, serviceIntf.ErrInvalidScope) {
+		t.Errorf("widening the scope: err = %v, want %v", err, serviceIntf.ErrInvalidScope)
+	}
+}
+
+func TestImpersonate(t *testing.T) {
+	repo := newMemoryRefreshTokenRepository()
+	actorID, subjectID := uuid.New(), uuid.New()
+	service := newTestAuthServiceWithProviders(t, repo, userRoles{actorID: {"support"}}, provider.NewEmptyUserDirectory())
+	actor := signIn(t, service, actorID, []string{"profile", "records:read"})
+
+	tokens, err := service.Impersonate(serviceIntf.ImpersonationRequest{
+		ActorID:        actorID,
+		ActorSessionID: actor.RefreshTokenID,
+		ActorScopes:    actor.Scopes(),
+		SubjectID:      subjectID,
+		UserAgent:      "test",
+		IP:             "127.0.0.1",
+		Scopes:         []string{"records:read"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := parseTestAccessToken(t, tokens.AccessToken)
+	if claims.Subject != subjectID.String() {
+		t.Errorf("sub = %s, want %s", claims.Subject, subjectID)
+	}
+	if want := (&utils.Actor{Sub: actorID.String()}); !reflect.DeepEqual(claims.Act, want) {
+		t.Errorf("act = %+v, want %+v", claims.Act, want)
+	}
+	session, err := repo.GetByID(claims.RefreshTokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.UserID != subjectID || session.ActorID == nil || *session.ActorID != actorID {
+		t.Errorf("session of %s by %v, want of %s by %s", session.UserID, session.ActorID, subjectID, actorID)
+	}
+
+	// The impersonating user stays in the chain of a token exchanged from
+	// the impersonated session, with or without the presented act claim.
+	want := &utils.Actor{ClientID: "backend", Act: &utils.Actor{Sub: actorID.String()}}
+	exchanged, err := exchange(t, service, claims, "backend", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims.Act = nil
+	withoutAct, err := exchange(t, service, claims, "backend", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range []*utils.Actor{exchanged.Act, withoutAct.Act} {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("act of an exchanged impersonation token = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestImpersonateRequiresRole(t *testing.T) {
+	repo := newMemoryRefreshTokenRepository()
+	supportID, patientID, subjectID := uuid.New(), uuid.New(), uuid.New()
+	roles := userRoles{supportID: {"support"}, patientID: {"patient"}}
+	service := newTestAuthServiceWithProviders(t, repo, roles, provider.NewEmptyUserDirectory())
+
+	support := signIn(t, service, supportID, nil)
+	patient := signIn(t, service, patientID, nil)
+	tokens, err := service.Impersonate(serviceIntf.ImpersonationRequest{
+		ActorID:        supportID,
+		ActorSessionID: support.RefreshTokenID,
+		SubjectID:      subjectID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	impersonated := parseTestAccessToken(t, tokens.AccessToken)
+
+	tests := []struct {
+		name      string
+		actorID   uuid.UUID
+		sessionID uuid.UUID
+		subjectID uuid.UUID
+	}{
+		{"actor without the role", patientID, patient.RefreshTokenID, subjectID},
+		{"session of another user", supportID, patient.RefreshTokenID, subjectID},
+		{"from an impersonated session", subjectID, impersonated.RefreshTokenID, patientID},
+		{"of oneself", supportID, support.RefreshTokenID, supportID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := len(repo.tokens)
+			_, err := service.Impersonate(serviceIntf.ImpersonationRequest{
+				ActorID:        tt.actorID,
+				ActorSessionID: tt.sessionID,
+				SubjectID:      tt.subjectID,
+			})
+			if !errors.Is(err, serviceIntf.ErrImpersonationForbidden) {
+				t.Errorf("err = %v, want %v", err, serviceIntf.ErrImpersonationForbidden)
+			}
+			if len(repo.tokens) != sessions {
+				t.Error("a refused impersonation opened a session")
+			}
+		})
+	}
+}
+
+func TestExchangeTokenChecksUserDirectory(t *testing.T) {
+	tests := []struct {
+		name    string
+		disable func(users userStatuses, userID, actorID uuid.UUID)
+		want    error
+	}{
+		{"user disabled", func(users userStatuses, userID, _ uuid.UUID) {
+			users[userID] = providerIntf.UserStatusDisabled
+		}, serviceIntf.ErrUserDisabled},
+		{"user removed", func(users userStatuses, userID, _ uuid.UUID) {
+			delete(users, userID)
+		}, serviceIntf.ErrUserNotFound},
+		{"actor blocked", func(users userStatuses, _, actorID uuid.UUID) {
+			users[actorID] = providerIntf.UserStatusBlocked
+		}, serviceIntf.ErrUserDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRefreshTokenRepository()
+			userID, actorID := uuid.New(), uuid.New()
+			users := userStatuses{userID: providerIntf.UserStatusActive, actorID: providerIntf.UserStatusActive}
+			service := newTestAuthServiceWithUsers(t, repo, users)
+
+			session := &model.RefreshToken{
+				ID:        uuid.New(),
+				UserID:    userID,
+				ActorID:   &actorID,
+				TokenHash: utils.HashRefreshToken("secret"),
+				CreatedAt: time.Now(),
+			}
+			if err := repo.Create(session); err != nil {
+				t.Fatal(err)
+			}
+			subject := &utils.AccessTokenClaims{RefreshTokenID: session.ID}
+
+			if _, err := exchange(t, service, subject, "backend", nil); err != nil {
+				t.Fatalf("exchange before the change: %v", err)
+			}
+			tt.disable(users, userID, actorID)
+			if _, err := exchange(t, service, subject, "backend", nil); !errors.Is(err, tt.want) {
+				t.Fatalf("exchange after the change: err = %v, want %v", err, tt.want)
+			}
+			if stored, _ := repo.GetByIDWithDeactivated(session.ID); stored.DeactivatedAt == nil {
+				t.Error("session was not revoked")
+			}
+		})
+	}
+}
@@ -1,11 +1,23 @@
 package intf
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/model"
+)
 
 type AuthService interface {
-	CreateTokens(userID uuid.UUID, userAgent, ip string) (string, string, error)
-	UpdateTokens(refreshTokenID uuid.UUID, rawRefreshToken, userAgent, ip string) (string, string, error)
+	CreateTokens(request TokenRequest) (*Tokens, error)
+	UpdateTokens(request RefreshRequest) (*Tokens, error)
+	ExchangeToken(request ExchangeRequest) (*Tokens, error)
+	Impersonate(request ImpersonationRequest) (*Tokens, error)
 	DeauthorizeUser(userID uuid.UUID) error
 	GetUserIDByRefreshTokenID(refreshTokenID uuid.UUID) (uuid.UUID, error)
 	IsTokenValid(refreshTokenID uuid.UUID) (bool, error)
+	GetSession(refreshTokenID uuid.UUID) (*model.RefreshToken, error)
+	InspectRefreshToken(rawRefreshToken string) (*model.RefreshToken, bool, error)
+	ListSessions(refreshTokenID uuid.UUID) ([]model.RefreshToken, error)
+	RevokeSession(refreshTokenID, sessionID uuid.UUID) error
+	RevokeSessionByTokenID(refreshTokenID uuid.UUID) error
+	RevokeOtherSessions(refreshTokenID uuid.UUID) error
 }
@@ -0,0 +1,31 @@
+package intf
+
+import "errors"
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrInvalidRefreshToken  = errors.New("invalid refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected. session revoked")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrUserAgentMismatch    = errors.New("user-agent mismatch. user deauthorized")
+	ErrTokenBindingMismatch = errors.New("refresh token is bound to another DPoP key or client certificate")
+	ErrClientMismatch       = errors.New("refresh token was issued to another client")
+	ErrRefreshConflict      = errors.New("refresh token was just rotated by another request. retry with the new token")
+
+	ErrRefreshTokenIDMissing = errors.New("access token is required for refresh tokens without an embedded id")
+
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionLimitReached = errors.New("maximum number of active sessions reached")
+
+	ErrInvalidScope = errors.New("requested scope is invalid or exceeds the granted scope")
+
+	ErrImpersonationForbidden = errors.New("actor is not allowed to impersonate users")
+
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserDisabled = errors.New("user is disabled. user deauthorized")
+
+	ErrInvalidCredentials  = errors.New("invalid login or password")
+	ErrPasswordTooShort    = errors.New("password is too short")
+	ErrImpersonatedSession = errors.New("not allowed in an impersonated session")
+	ErrPasswordCheckBusy   = errors.New("too many password checks in progress. retry later")
+)
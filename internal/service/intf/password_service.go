@@ -0,0 +1,26 @@
+package intf
+
+import "github.com/google/uuid"
+
+// LoginRequest is a sign-in with a login and password. The embedded
+// TokenRequest describes the session to open; its UserID is filled in from
+// the credentials.
+type LoginRequest struct {
+	Login    string
+	Password string
+	TokenRequest
+}
+
+// PasswordChangeRequest changes the password of the user signed in to the
+// session behind RefreshTokenID.
+type PasswordChangeRequest struct {
+	UserID          uuid.UUID
+	RefreshTokenID  uuid.UUID
+	CurrentPassword string
+	NewPassword     string
+}
+
+type PasswordService interface {
+	Login(request LoginRequest) (*Tokens, error)
+	ChangePassword(request PasswordChangeRequest) error
+}
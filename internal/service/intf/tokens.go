@@ -0,0 +1,87 @@
+package intf
+
+import (
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/utils"
+)
+
+// Binding is the proof of possession presented with a request: the
+// thumbprint of a DPoP key, of a TLS client certificate, or both. Tokens
+// issued for a bound request are bound to it too.
+type Binding struct {
+	JKT string
+	X5T string
+}
+
+func (b Binding) IsZero() bool {
+	return b.JKT == "" && b.X5T == ""
+}
+
+// TokenRequest describes a sign-in. ClientID and Nonce come from the OpenID
+// Connect client and end up in the id_token; both are optional. Scopes are
+// granted to the whole session, as far as the client may have them:
+// ClientAuthenticated is set when ClientID was authenticated as a client from
+// OAUTH_CLIENTS.
+type TokenRequest struct {
+	UserID              uuid.UUID
+	UserAgent           string
+	IP                  string
+	ClientID            string
+	ClientAuthenticated bool
+	Nonce               string
+	Scopes              []string
+	Binding             Binding
+}
+
+// RefreshRequest describes a refresh token exchange. RefreshTokenID is only
+// needed for legacy refresh tokens without an embedded ID. Scopes may narrow
+// the scope of the new access token; nil keeps the granted scope. ClientID is
+// the client redeeming the token: authenticated for confidential clients,
+// empty for first-party callers.
+type RefreshRequest struct {
+	RefreshTokenID uuid.UUID
+	RefreshToken   string
+	UserAgent      string
+	IP             string
+	ClientID       string
+	Scopes         []string
+	Binding        Binding
+}
+
+// ExchangeRequest asks for a narrower access token for the session behind
+// RefreshTokenID on behalf of ClientID. SubjectScopes and SubjectAct are
+// the scope and act claim of the presented token: Scopes may only narrow
+// the former and ClientID is added in front of the latter.
+type ExchangeRequest struct {
+	RefreshTokenID uuid.UUID
+	SubjectScopes  []string
+	SubjectAct     *utils.Actor
+	Scopes         []string
+	ClientID       string
+	Binding        Binding
+}
+
+// ImpersonationRequest asks for a session of SubjectID opened by ActorID,
+// who presented a token of the session ActorSessionID with ActorScopes.
+type ImpersonationRequest struct {
+	ActorID        uuid.UUID
+	ActorSessionID uuid.UUID
+	ActorScopes    []string
+	SubjectID      uuid.UUID
+	UserAgent      string
+	IP             string
+	ClientID       string
+	Scopes         []string
+	Binding        Binding
+}
+
+// Tokens is an issued token set. Binding is what the access token is bound
+// to; a token bound to a DPoP key is of type DPoP rather than Bearer.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	Scopes       []string
+	Binding      Binding
+}
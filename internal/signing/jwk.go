@@ -0,0 +1,163 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"medods_test_task/internal/dto"
+)
+
+// PublicJWK returns the public half of the key in JWK form. Symmetric keys
+// have no public half and are never published.
+func (k *Key) PublicJWK() (dto.JWK, error) {
+	jwk, err := PublicKeyToJWK(k.verifyKey)
+	if err != nil {
+		return dto.JWK{}, err
+	}
+	jwk.Kid = k.ID
+	jwk.Use = "sig"
+	jwk.Alg = k.Method.Alg()
+	return jwk, nil
+}
+
+func PublicKeyToJWK(publicKey interface{}) (dto.JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return dto.JWK{
+			Kty: "RSA",
+			N:   encodeSegment(key.N.Bytes()),
+			E:   encodeSegment(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return dto.JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   encodeSegment(key.X.FillBytes(make([]byte, size))),
+			Y:   encodeSegment(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return dto.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encodeSegment(key),
+		}, nil
+	default:
+		return dto.JWK{}, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// PublicKeyFromJWK is the inverse of PublicKeyToJWK. Only the curves the
+// keyring itself supports are accepted.
+func PublicKeyFromJWK(jwk dto.JWK) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeSegment(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		x, err := decodeSegment(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid EC key")
+		}
+		return key, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		x, err := decodeSegment(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+}
+
+// Thumbprint computes the RFC 7638 SHA-256 thumbprint of a public JWK.
+func Thumbprint(jwk dto.JWK) (string, error) {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return encodeSegment(sum[:]), nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64url value: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,132 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmHS512 = "HS512"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const defaultSymmetricKeyID = "default"
+
+func SupportedAlgorithms() []string {
+	return []string{AlgorithmHS512, AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}
+}
+
+// Key is a single JWT signing key together with the key used to verify
+// the signatures it produces. For HS512 both are the shared secret.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (k *Key) SignKey() interface{} {
+	return k.signKey
+}
+
+func (k *Key) VerifyKey() interface{} {
+	return k.verifyKey
+}
+
+func (k *Key) IsSymmetric() bool {
+	return k.Method.Alg() == AlgorithmHS512
+}
+
+// NewSymmetricKey builds an HS512 key from a shared secret.
+func NewSymmetricKey(secret []byte, kid string) (*Key, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("empty secret for %s", AlgorithmHS512)
+	}
+	if kid == "" {
+		kid = defaultSymmetricKeyID
+	}
+	return &Key{
+		ID:        kid,
+		Method:    jwt.SigningMethodHS512,
+		signKey:   secret,
+		verifyKey: secret,
+	}, nil
+}
+
+// LoadKey reads a PEM encoded private key for an asymmetric algorithm.
+// When kid is empty the RFC 7638 thumbprint of the public key is used.
+func LoadKey(alg, path, kid string) (*Key, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	return ParseKey(alg, pemBytes, kid)
+}
+
+func ParseKey(alg string, pemBytes []byte, kid string) (*Key, error) {
+	var (
+		method    jwt.SigningMethod
+		signKey   crypto.Signer
+		verifyKey crypto.PublicKey
+	)
+
+	switch alg {
+	case AlgorithmRS256:
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		}
+		if privateKey.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key must be at least 2048 bits")
+		}
+		method, signKey, verifyKey = jwt.SigningMethodRS256, privateKey, &privateKey.PublicKey
+	case AlgorithmES256:
+		privateKey, err := jwt.ParseECPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EC private key: %w", err)
+		}
+		if privateKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%s requires a P-256 key", AlgorithmES256)
+		}
+		method, signKey, verifyKey = jwt.SigningMethodES256, privateKey, &privateKey.PublicKey
+	case AlgorithmEdDSA:
+		privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Ed25519 private key: %w", err)
+		}
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires an Ed25519 key", AlgorithmEdDSA)
+		}
+		method, signKey, verifyKey = jwt.SigningMethodEdDSA, edKey, edKey.Public()
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+
+	key := &Key{
+		ID:        kid,
+		Method:    method,
+		signKey:   signKey,
+		verifyKey: verifyKey,
+	}
+
+	if key.ID == "" {
+		jwk, err := key.PublicJWK()
+		if err != nil {
+			return nil, err
+		}
+		key.ID, err = Thumbprint(jwk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,402 @@
+package signing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"medods_test_task/internal/dto"
+)
+
+// unknownKeyReloadInterval is how often Resolve may reload the keyring for
+// a kid it does not know, so tokens with made-up kids cannot force a reload
+// per request.
+const unknownKeyReloadInterval = 10 * time.Second
+
+// JWKSMaxAge is how long clients may cache the published key set. A staged
+// key is published at least that long before it signs anything.
+const JWKSMaxAge = 5 * time.Minute
+
+type KeyState string
+
+const (
+	KeyStateActive     KeyState = "active"
+	KeyStateVerifyOnly KeyState = "verify_only"
+	KeyStateRetired    KeyState = "retired"
+)
+
+// Keyring holds the active signing key and the verify-only keys that were
+// active recently enough for tokens signed by them to still be unexpired.
+//
+// A keyring is either static (a single key from the environment) or backed
+// by a directory with a manifest, in which case it can be rotated and
+// reloaded while the service is running.
+type Keyring struct {
+	mu              sync.RWMutex
+	store           *manifestStore
+	verifyWindow    time.Duration
+	activationDelay time.Duration
+	active          *Key
+	keys            map[string]*Key
+	modTime         time.Time
+
+	// unknownKeyMu serializes reloads for unknown kids and guards
+	// unknownKeyReloadedAt, the time of the last one.
+	unknownKeyMu         sync.Mutex
+	unknownKeyReloadedAt time.Time
+}
+
+func NewStaticKeyring(key *Key) *Keyring {
+	return &Keyring{
+		active: key,
+		keys:   map[string]*Key{key.ID: key},
+	}
+}
+
+// OpenKeyring loads the keyring stored in dir. If the directory holds no
+// manifest yet, a first active key for alg is generated. verifyWindow is
+// how long a key stays usable for verification after it is rotated out; it
+// should be at least the access token TTL. activationDelay is how long a
+// key staged by Rotate is only published before it becomes active; it
+// should be at least the reload interval plus JWKSMaxAge.
+func OpenKeyring(dir, alg string, verifyWindow, activationDelay time.Duration) (*Keyring, error) {
+	store := &manifestStore{dir: dir, alg: alg}
+	if err := store.init(); err != nil {
+		return nil, err
+	}
+
+	r := &Keyring{
+		store:           store,
+		verifyWindow:    verifyWindow,
+		activationDelay: activationDelay,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Keyring) Active() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active
+}
+
+// Lookup returns the key with the given kid if it may still be used to
+// verify tokens.
+func (r *Keyring) Lookup(kid string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+// Resolve is Lookup for verifying a token. A kid the keyring does not know
+// may be of a key another instance or keyctl added since the last reload,
+// so the manifest is reloaded before the kid is given up on. Such reloads
+// happen at most every unknownKeyReloadInterval.
+func (r *Keyring) Resolve(kid string) (*Key, bool) {
+	if key, ok := r.Lookup(kid); ok || !r.IsRotatable() {
+		return key, ok
+	}
+
+	r.unknownKeyMu.Lock()
+	if time.Since(r.unknownKeyReloadedAt) >= unknownKeyReloadInterval {
+		r.unknownKeyReloadedAt = time.Now()
+		if err := r.Reload(); err != nil {
+			log.Printf("failed to reload keyring for unknown kid %q: %v", kid, err)
+		}
+	}
+	r.unknownKeyMu.Unlock()
+
+	return r.Lookup(kid)
+}
+
+// PublicJWKs returns the public halves of every key that can verify tokens,
+// active key first. Symmetric keys are skipped.
+func (r *Keyring) PublicJWKs() ([]dto.JWK, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []dto.JWK{}
+	if r.active.IsSymmetric() {
+		return keys, nil
+	}
+
+	jwk, err := r.active.PublicJWK()
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, jwk)
+
+	kids := make([]string, 0, len(r.keys))
+	for kid := range r.keys {
+		if kid != r.active.ID {
+			kids = append(kids, kid)
+		}
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := r.keys[kid]
+		if key.IsSymmetric() {
+			continue
+		}
+		jwk, err := key.PublicJWK()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwk)
+	}
+	return keys, nil
+}
+
+func (r *Keyring) IsRotatable() bool {
+	return r.store != nil
+}
+
+// Entries lists every key in the manifest including retired ones.
+func (r *Keyring) Entries() ([]ManifestEntry, error) {
+	if !r.IsRotatable() {
+		return nil, fmt.Errorf("keyring is static")
+	}
+	m, err := r.store.read()
+	if err != nil {
+		return nil, err
+	}
+	return m.Keys, nil
+}
+
+// Reload activates a staged key whose time has come, retires verify-only
+// keys whose window has passed and re-reads the manifest if it changed on
+// disk, e.g. after a rotation done by keyctl or another instance.
+func (r *Keyring) Reload() error {
+	if !r.IsRotatable() {
+		return nil
+	}
+
+	err := r.store.update(func(m *manifest) (bool, error) {
+		now := time.Now().UTC()
+		activated := m.activateStaged(now)
+		retired := m.retireExpired(now, r.verifyWindow)
+		return activated || retired, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	modTime, err := r.store.modTime()
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	changed := !modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+
+	if !changed {
+		return nil
+	}
+	return r.load()
+}
+
+// Rotate stages a new signing key. It is published and accepted for
+// verification at once but becomes the active key only after the
+// activation delay, once every instance has reloaded the keyring and
+// clients have refreshed their cached key set; until then tokens signed by
+// it would fail verification elsewhere. On activation the previous active
+// key becomes verify-only so tokens it signed keep working until they
+// expire. If a key is already staged, Rotate returns it and stages nothing.
+func (r *Keyring) Rotate() (ManifestEntry, error) {
+	if !r.IsRotatable() {
+		return ManifestEntry{}, fmt.Errorf("keyring is static")
+	}
+
+	var staged ManifestEntry
+	err := r.store.update(func(m *manifest) (bool, error) {
+		now := time.Now().UTC()
+		changed := m.activateStaged(now)
+		if m.retireExpired(now, r.verifyWindow) {
+			changed = true
+		}
+		if entry := m.staged(); entry != nil {
+			staged = *entry
+			return changed, nil
+		}
+
+		entry, err := r.store.generate()
+		if err != nil {
+			return false, err
+		}
+		activateAt := now.Add(r.activationDelay)
+		entry.State = KeyStateVerifyOnly
+		entry.ActivateAt = &activateAt
+		m.Keys = append(m.Keys, entry)
+		staged = entry
+		return true, nil
+	})
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	if err := r.load(); err != nil {
+		return ManifestEntry{}, err
+	}
+	return staged, nil
+}
+
+// Retire immediately stops accepting tokens signed by kid. The active key
+// cannot be retired; rotate first.
+func (r *Keyring) Retire(kid string) error {
+	if !r.IsRotatable() {
+		return fmt.Errorf("keyring is static")
+	}
+
+	err := r.store.update(func(m *manifest) (bool, error) {
+		found := false
+		for i := range m.Keys {
+			if m.Keys[i].KID != kid {
+				continue
+			}
+			if m.Keys[i].State == KeyStateActive {
+				return false, fmt.Errorf("key %s is active, rotate before retiring it", kid)
+			}
+			now := time.Now().UTC()
+			m.Keys[i].State = KeyStateRetired
+			m.Keys[i].RetiredAt = &now
+			m.Keys[i].ActivateAt = nil
+			found = true
+		}
+		if !found {
+			return false, fmt.Errorf("key %s not found", kid)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.load()
+}
+
+// RunAutoRotation rotates the keyring whenever the active key is older than
+// interval and reloads it from disk every reloadInterval. It blocks until
+// ctx is cancelled. A zero interval disables scheduled rotation.
+func (r *Keyring) RunAutoRotation(ctx context.Context, interval, reloadInterval time.Duration) {
+	if !r.IsRotatable() || reloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.Reload(); err != nil {
+			log.Printf("failed to reload keyring: %v", err)
+			continue
+		}
+
+		if interval <= 0 {
+			continue
+		}
+
+		due, err := r.rotationDue(interval)
+		if err != nil {
+			log.Printf("failed to read keyring: %v", err)
+			continue
+		}
+		if !due {
+			continue
+		}
+
+		entry, err := r.Rotate()
+		if err != nil {
+			log.Printf("failed to rotate signing key: %v", err)
+			continue
+		}
+		log.Printf("Signing key staged. Kid: %s. Active from %s", entry.KID, entry.ActivateAt.Format(time.RFC3339))
+	}
+}
+
+// rotationDue reports whether the active key is older than interval and no
+// key is staged to replace it yet.
+func (r *Keyring) rotationDue(interval time.Duration) (bool, error) {
+	m, err := r.store.read()
+	if err != nil {
+		return false, err
+	}
+	if m.staged() != nil {
+		return false, nil
+	}
+	for _, entry := range m.Keys {
+		if entry.State == KeyStateActive {
+			return time.Since(entry.CreatedAt) >= interval, nil
+		}
+	}
+	return false, fmt.Errorf("keyring has no active key")
+}
+
+func (r *Keyring) load() error {
+	modTime, err := r.store.modTime()
+	if err != nil {
+		return err
+	}
+
+	m, err := r.store.read()
+	if err != nil {
+		return err
+	}
+
+	var active *Key
+	keys := make(map[string]*Key)
+	now := time.Now().UTC()
+
+	for _, entry := range m.Keys {
+		if entry.State == KeyStateRetired {
+			continue
+		}
+		if entry.State == KeyStateVerifyOnly && entry.verifyExpired(now, r.verifyWindow) {
+			continue
+		}
+
+		key, err := r.store.loadKey(entry)
+		if err != nil {
+			return fmt.Errorf("failed to load key %s: %w", entry.KID, err)
+		}
+		keys[key.ID] = key
+
+		if entry.State == KeyStateActive {
+			if active != nil {
+				return fmt.Errorf("keyring has more than one active key")
+			}
+			active = key
+		}
+	}
+
+	if active == nil {
+		return fmt.Errorf("keyring has no active key")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active = active
+	r.keys = keys
+	r.modTime = modTime
+	return nil
+}
+
+func fileModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,258 @@
+package signing
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestKeyring(t *testing.T, dir string, verifyWindow, activationDelay time.Duration) *Keyring {
+	t.Helper()
+	keyring, err := OpenKeyring(dir, AlgorithmES256, verifyWindow, activationDelay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+// shiftManifest rewrites the stored manifest, standing in for time passing.
+func shiftManifest(t *testing.T, keyring *Keyring, change func(entry *ManifestEntry)) {
+	t.Helper()
+	err := keyring.store.update(func(m *manifest) (bool, error) {
+		for i := range m.Keys {
+			change(&m.Keys[i])
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func jwkIDs(t *testing.T, keyring *Keyring) []string {
+	t.Helper()
+	jwks, err := keyring.PublicJWKs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kids := make([]string, len(jwks))
+	for i, jwk := range jwks {
+		kids[i] = jwk.Kid
+	}
+	return kids
+}
+
+func states(t *testing.T, keyring *Keyring) map[string]KeyState {
+	t.Helper()
+	entries, err := keyring.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[string]KeyState, len(entries))
+	for _, entry := range entries {
+		states[entry.KID] = entry.State
+	}
+	return states
+}
+
+func TestRotateStagesKeyBeforeActivation(t *testing.T) {
+	keyring := openTestKeyring(t, t.TempDir(), time.Hour, time.Hour)
+	oldKID := keyring.Active().ID
+
+	staged, err := keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged.State != KeyStateVerifyOnly || staged.ActivateAt == nil {
+		t.Fatalf("staged key is %s, activating at %v; want verify_only with an activation time", staged.State, staged.ActivateAt)
+	}
+	if keyring.Active().ID != oldKID {
+		t.Error("the staged key became active before its activation time")
+	}
+	if _, ok := keyring.Lookup(staged.KID); !ok {
+		t.Error("the staged key does not verify")
+	}
+	if kids := jwkIDs(t, keyring); len(kids) != 2 || kids[0] != oldKID || kids[1] != staged.KID {
+		t.Errorf("JWKS = %v, want the active key %s followed by the staged key %s", kids, oldKID, staged.KID)
+	}
+
+	again, err := keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.KID != staged.KID || len(states(t, keyring)) != 2 {
+		t.Error("a second rotation staged another key instead of returning the staged one")
+	}
+
+	if err := keyring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if keyring.Active().ID != oldKID {
+		t.Error("a reload activated the staged key before its activation time")
+	}
+
+	shiftManifest(t, keyring, func(entry *ManifestEntry) {
+		if entry.ActivateAt != nil {
+			past := time.Now().UTC().Add(-time.Second)
+			entry.ActivateAt = &past
+		}
+	})
+	if err := keyring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if keyring.Active().ID != staged.KID {
+		t.Fatalf("active key = %s after the activation time, want %s", keyring.Active().ID, staged.KID)
+	}
+	want := map[string]KeyState{oldKID: KeyStateVerifyOnly, staged.KID: KeyStateActive}
+	if got := states(t, keyring); got[oldKID] != want[oldKID] || got[staged.KID] != want[staged.KID] {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+	if kids := jwkIDs(t, keyring); len(kids) != 2 || kids[0] != staged.KID {
+		t.Errorf("JWKS = %v, want the new active key first", kids)
+	}
+}
+
+func TestReloadRetiresExpiredKeys(t *testing.T) {
+	keyring := openTestKeyring(t, t.TempDir(), time.Hour, 0)
+	oldKID := keyring.Active().ID
+	if _, err := keyring.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if keyring.Active().ID == oldKID {
+		t.Fatal("the staged key was not activated")
+	}
+	if _, ok := keyring.Lookup(oldKID); !ok {
+		t.Fatal("the rotated out key stopped verifying within its window")
+	}
+
+	shiftManifest(t, keyring, func(entry *ManifestEntry) {
+		if entry.KID == oldKID {
+			past := time.Now().UTC().Add(-2 * time.Hour)
+			entry.RotatedAt = &past
+		}
+	})
+	if err := keyring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keyring.Lookup(oldKID); ok {
+		t.Error("the rotated out key still verifies after its window")
+	}
+	if got := states(t, keyring)[oldKID]; got != KeyStateRetired {
+		t.Errorf("state of the expired key = %s, want %s", got, KeyStateRetired)
+	}
+	if kids := jwkIDs(t, keyring); len(kids) != 1 {
+		t.Errorf("JWKS = %v, want only the active key", kids)
+	}
+}
+
+func TestRetire(t *testing.T) {
+	keyring := openTestKeyring(t, t.TempDir(), time.Hour, time.Hour)
+	staged, err := keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := keyring.Retire(keyring.Active().ID); err == nil {
+		t.Error("the active key was retired")
+	}
+	if err := keyring.Retire("unknown"); err == nil {
+		t.Error("an unknown key was retired")
+	}
+
+	if err := keyring.Retire(staged.KID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keyring.Lookup(staged.KID); ok {
+		t.Error("a retired key still verifies")
+	}
+	if kids := jwkIDs(t, keyring); len(kids) != 1 || kids[0] != keyring.Active().ID {
+		t.Errorf("JWKS = %v, want only the active key", kids)
+	}
+
+	// With the staged key retired, a rotation stages a new one.
+	next, err := keyring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.KID == staged.KID {
+		t.Error("rotation returned the retired key")
+	}
+}
+
+func TestRotateFromSeveralInstances(t *testing.T) {
+	dir := t.TempDir()
+	openTestKeyring(t, dir, time.Hour, time.Hour)
+
+	instances := make([]*Keyring, 8)
+	for i := range instances {
+		instances[i] = openTestKeyring(t, dir, time.Hour, time.Hour)
+	}
+
+	var wg sync.WaitGroup
+	staged := make([]string, len(instances))
+	for i, keyring := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, err := keyring.Rotate()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			staged[i] = entry.KID
+		}()
+	}
+	wg.Wait()
+
+	if got := len(states(t, instances[0])); got != 2 {
+		t.Errorf("manifest holds %d keys after concurrent rotations, want 2", got)
+	}
+	for _, kid := range staged {
+		if kid != staged[0] {
+			t.Errorf("instances staged different keys: %v", staged)
+			break
+		}
+	}
+}
+
+func TestStaticKeyringJWKS(t *testing.T) {
+	symmetric, err := NewSymmetricKey([]byte("test-secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kids := jwkIDs(t, NewStaticKeyring(symmetric)); len(kids) != 0 {
+		t.Errorf("JWKS of an HS512 keyring = %v, want none", kids)
+	}
+}
+
+func TestResolveReloadsForUnknownKid(t *testing.T) {
+	dir := t.TempDir()
+	rotating := openTestKeyring(t, dir, time.Hour, time.Hour)
+	other := openTestKeyring(t, dir, time.Hour, time.Hour)
+
+	staged, err := rotating.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.Lookup(staged.KID); ok {
+		t.Fatal("the other instance knows the staged key before reloading")
+	}
+	if _, ok := other.Resolve(staged.KID); !ok {
+		t.Fatal("Resolve did not reload the keyring for an unknown kid")
+	}
+
+	// Another unknown kid right after that reload is rejected without one.
+	if err := rotating.Retire(staged.KID); err != nil {
+		t.Fatal(err)
+	}
+	next, err := rotating.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := other.Resolve(next.KID); ok {
+		t.Error("Resolve reloaded the keyring again within unknownKeyReloadInterval")
+	}
+}
@@ -0,0 +1,275 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	manifestFileName = "keyring.json"
+	// lockFileName guards read-modify-write cycles of the manifest.
+	lockFileName = "keyring.lock"
+)
+
+type ManifestEntry struct {
+	KID       string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	File      string     `json:"file"`
+	State     KeyState   `json:"state"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	// ActivateAt is set on a key staged by a rotation: it is verify-only
+	// until then and becomes the active key afterwards.
+	ActivateAt *time.Time `json:"activate_at,omitempty"`
+}
+
+func (e *ManifestEntry) isStaged() bool {
+	return e.State == KeyStateVerifyOnly && e.ActivateAt != nil
+}
+
+func (e *ManifestEntry) verifyExpired(now time.Time, verifyWindow time.Duration) bool {
+	return e.RotatedAt != nil && now.After(e.RotatedAt.Add(verifyWindow))
+}
+
+type manifest struct {
+	Keys []ManifestEntry `json:"keys"`
+}
+
+// staged returns the key waiting for activation, if any.
+func (m *manifest) staged() *ManifestEntry {
+	for i := range m.Keys {
+		if m.Keys[i].isStaged() {
+			return &m.Keys[i]
+		}
+	}
+	return nil
+}
+
+// activateStaged makes a staged key whose time has come the active key and
+// the previous active key verify-only. It reports whether anything changed.
+func (m *manifest) activateStaged(now time.Time) bool {
+	staged := m.staged()
+	if staged == nil || now.Before(*staged.ActivateAt) {
+		return false
+	}
+	for i := range m.Keys {
+		if m.Keys[i].State == KeyStateActive {
+			m.Keys[i].State = KeyStateVerifyOnly
+			m.Keys[i].RotatedAt = &now
+		}
+	}
+	staged.State = KeyStateActive
+	staged.ActivateAt = nil
+	return true
+}
+
+// retireExpired marks verify-only keys whose window has passed as retired
+// and reports whether anything changed.
+func (m *manifest) retireExpired(now time.Time, verifyWindow time.Duration) bool {
+	changed := false
+	for i := range m.Keys {
+		entry := &m.Keys[i]
+		if entry.State == KeyStateVerifyOnly && entry.verifyExpired(now, verifyWindow) {
+			entry.State = KeyStateRetired
+			entry.RetiredAt = &now
+			changed = true
+		}
+	}
+	return changed
+}
+
+// manifestStore keeps key material as one file per key next to a JSON
+// manifest describing each key's state.
+type manifestStore struct {
+	dir string
+	alg string
+}
+
+func (s *manifestStore) path() string {
+	return filepath.Join(s.dir, manifestFileName)
+}
+
+func (s *manifestStore) init() error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %w", err)
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = os.Stat(s.path())
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	entry, err := s.generate()
+	if err != nil {
+		return err
+	}
+	return s.write(&manifest{Keys: []ManifestEntry{entry}})
+}
+
+func (s *manifestStore) modTime() (time.Time, error) {
+	return fileModTime(s.path())
+}
+
+func (s *manifestStore) read() (*manifest, error) {
+	data, err := os.ReadFile(s.path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// update applies change to the manifest under the keyring lock and writes
+// the result if change reports that it modified it. Instances and keyctl
+// sharing the directory therefore never overwrite each other's changes.
+func (s *manifestStore) update(change func(m *manifest) (bool, error)) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m, err := s.read()
+	if err != nil {
+		return err
+	}
+	changed, err := change(m)
+	if err != nil || !changed {
+		return err
+	}
+	return s.write(m)
+}
+
+// write replaces the manifest atomically so a concurrent reader never sees
+// a partially written file.
+func (s *manifestStore) write(m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, manifestFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path())
+}
+
+func (s *manifestStore) loadKey(entry ManifestEntry) (*Key, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, entry.File))
+	if err != nil {
+		return nil, err
+	}
+	if entry.Algorithm == AlgorithmHS512 {
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode secret: %w", err)
+		}
+		return NewSymmetricKey(secret, entry.KID)
+	}
+	return ParseKey(entry.Algorithm, data, entry.KID)
+}
+
+// generate creates fresh key material for the store's algorithm, writes it
+// to disk and returns the manifest entry for it as the active key.
+func (s *manifestStore) generate() (ManifestEntry, error) {
+	data, err := generateKeyMaterial(s.alg)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	now := time.Now().UTC()
+	entry := ManifestEntry{
+		Algorithm: s.alg,
+		State:     KeyStateActive,
+		CreatedAt: now,
+	}
+
+	if s.alg == AlgorithmHS512 {
+		suffix := make([]byte, 6)
+		if _, err := rand.Read(suffix); err != nil {
+			return ManifestEntry{}, err
+		}
+		entry.KID = now.Format("20060102T150405Z") + "-" + base64.RawURLEncoding.EncodeToString(suffix)
+	} else {
+		key, err := ParseKey(s.alg, data, "")
+		if err != nil {
+			return ManifestEntry{}, err
+		}
+		entry.KID = key.ID
+	}
+	entry.File = entry.KID + ".key"
+
+	if err := os.WriteFile(filepath.Join(s.dir, entry.File), data, 0o600); err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to write key file: %w", err)
+	}
+	return entry, nil
+}
+
+func generateKeyMaterial(alg string) ([]byte, error) {
+	var (
+		privateKey interface{}
+		err        error
+	)
+
+	switch alg {
+	case AlgorithmHS512:
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return []byte(base64.StdEncoding.EncodeToString(secret) + "\n"), nil
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
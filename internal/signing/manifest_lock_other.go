@@ -0,0 +1,41 @@
+//go:build !unix
+
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockRetry is how often lock tries again to create a lock file held by
+// someone else, and lockTimeout how long it keeps trying.
+const (
+	lockRetry   = 10 * time.Millisecond
+	lockTimeout = 10 * time.Second
+)
+
+// lock creates the lock file of the keyring directory exclusively, waiting
+// while another instance or keyctl run holds it, and returns the function
+// removing it. Without flock a lock file left by a crashed process has to
+// be removed by hand.
+func (s *manifestStore) lock() (func(), error) {
+	path := filepath.Join(s.dir, lockFileName)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock keyring: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock keyring: %s is held", path)
+		}
+		time.Sleep(lockRetry)
+	}
+}
@@ -0,0 +1,32 @@
+package impl
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"medods_test_task/internal/config"
+	"medods_test_task/internal/utils"
+)
+
+// validationOptions are the claim checks shared by every format.
+func validationOptions() []jwt.ParserOption {
+	cfg := config.Load()
+	return []jwt.ParserOption{
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.JWTAudience),
+		jwt.WithLeeway(cfg.JWTLeeway),
+	}
+}
+
+// validateTokenClaims applies validationOptions to claims of formats that
+// are not parsed by the JWT library.
+func validateTokenClaims(claims *utils.AccessTokenClaims, validateClaims bool) (*utils.AccessTokenClaims, error) {
+	if !validateClaims {
+		return claims, nil
+	}
+	if err := jwt.NewValidator(validationOptions()...).Validate(claims); err != nil {
+		return nil, fmt.Errorf("token has invalid claims: %w", err)
+	}
+	return claims, nil
+}
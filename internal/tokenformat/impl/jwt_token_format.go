@@ -0,0 +1,64 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"medods_test_task/internal/signing"
+	"medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+// JWTTokenFormat issues JWTs signed with the active key of the keyring and
+// names that key in the kid header.
+type JWTTokenFormat struct {
+	keyring *signing.Keyring
+}
+
+func NewJWTTokenFormat(keyring *signing.Keyring) intf.TokenFormat {
+	return &JWTTokenFormat{keyring: keyring}
+}
+
+func (f *JWTTokenFormat) Issue(claims *utils.AccessTokenClaims) (string, error) {
+	key := f.keyring.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey())
+}
+
+func (f *JWTTokenFormat) Parse(tokenStr string, validateClaims bool) (*utils.AccessTokenClaims, error) {
+	options := append(validationOptions(), jwt.WithValidMethods(signing.SupportedAlgorithms()))
+	if !validateClaims {
+		options = append(options, jwt.WithoutClaimsValidation())
+	}
+
+	token, err := jwt.ParseWithClaims(tokenStr, &utils.AccessTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		signingKey := f.keyring.Active()
+		if kid, ok := token.Header["kid"].(string); ok {
+			if signingKey, ok = f.keyring.Resolve(kid); !ok {
+				return nil, fmt.Errorf("unknown signing key: %v", kid)
+			}
+		}
+		if token.Method.Alg() != signingKey.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return signingKey.VerifyKey(), nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*utils.AccessTokenClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// Discard does nothing: a self-contained token is not stored, and one whose
+// session was never saved fails the session check wherever it is presented.
+func (f *JWTTokenFormat) Discard(string) error {
+	return nil
+}
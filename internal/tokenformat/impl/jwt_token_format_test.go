@@ -0,0 +1,66 @@
+package impl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/signing"
+	"medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+// TestParseReloadsKeyringForUnknownKid issues a token on one instance right
+// after its keyring activated a new key and parses it on another instance
+// that has not reloaded the keyring yet.
+func TestParseReloadsKeyringForUnknownKid(t *testing.T) {
+	formats := []struct {
+		name      string
+		algorithm string
+		format    func(keyring *signing.Keyring) (intf.TokenFormat, error)
+	}{
+		{"JWT", signing.AlgorithmES256, func(keyring *signing.Keyring) (intf.TokenFormat, error) {
+			return NewJWTTokenFormat(keyring), nil
+		}},
+		{"v4.public", signing.AlgorithmEdDSA, NewPASETOPublicTokenFormat},
+	}
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			dir := t.TempDir()
+			issuing, err := signing.OpenKeyring(dir, f.algorithm, time.Hour, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsing, err := signing.OpenKeyring(dir, f.algorithm, time.Hour, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := issuing.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			if err := issuing.Reload(); err != nil {
+				t.Fatal(err)
+			}
+
+			issuer, err := f.format(issuing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parser, err := f.format(parsing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := issuer.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+				UserID:         uuid.New(),
+				RefreshTokenID: uuid.New(),
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := parser.Parse(token, true); err != nil {
+				t.Errorf("Parse with a keyring that has not seen the signing key: %v", err)
+			}
+		})
+	}
+}
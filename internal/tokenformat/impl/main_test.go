@@ -0,0 +1,20 @@
+package impl
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	env := map[string]string{
+		"ACCESS_TOKEN_TTL":     "15m",
+		"JWT_SECRET":           "test-secret",
+		"DB_DSN":               "unused",
+		"WEBHOOK":              "http://127.0.0.1:1/",
+		"REFRESH_TOKEN_PEPPER": "test-pepper",
+	}
+	for key, value := range env {
+		_ = os.Setenv(key, value)
+	}
+	os.Exit(m.Run())
+}
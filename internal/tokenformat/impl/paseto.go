@@ -0,0 +1,112 @@
+package impl
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"medods_test_task/internal/utils"
+)
+
+// PASETO registered claims are the same as in a JWT, except that exp, nbf
+// and iat are RFC 3339 strings rather than numbers.
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+// pae is the Pre-Authentication Encoding of the PASETO specification.
+func pae(pieces ...[]byte) []byte {
+	output := le64(uint64(len(pieces)))
+	for _, piece := range pieces {
+		output = append(output, le64(uint64(len(piece)))...)
+		output = append(output, piece...)
+	}
+	return output
+}
+
+func le64(n uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, n&(1<<63-1))
+}
+
+// pasetoEncoding is unpadded base64url that rejects non-zero trailing bits,
+// so that every token has exactly one encoding.
+var pasetoEncoding = base64.RawURLEncoding.Strict()
+
+// splitPASETO checks the header of token and returns its decoded body and
+// footer.
+func splitPASETO(token, header string) ([]byte, []byte, error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, fmt.Errorf("token is not %s", strings.TrimSuffix(header, "."))
+	}
+	encodedBody, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, header), ".")
+
+	body, err := pasetoEncoding.DecodeString(encodedBody)
+	if err != nil {
+		return nil, nil, errors.New("token is malformed")
+	}
+	footer, err := pasetoEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, nil, errors.New("token footer is malformed")
+	}
+	return body, footer, nil
+}
+
+func joinPASETO(header string, body, footer []byte) string {
+	token := header + pasetoEncoding.EncodeToString(body)
+	if len(footer) > 0 {
+		token += "." + pasetoEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// encodePASETOClaims serialises claims like the JWT format does and then
+// rewrites the time claims as RFC 3339 strings.
+func encodePASETOClaims(claims *utils.AccessTokenClaims) ([]byte, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	for _, name := range pasetoTimeClaims {
+		if seconds, ok := payload[name].(float64); ok {
+			payload[name] = time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+		}
+	}
+	return json.Marshal(payload)
+}
+
+// decodePASETOClaims is the inverse of encodePASETOClaims.
+func decodePASETOClaims(data []byte) (*utils.AccessTokenClaims, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("invalid token payload: %w", err)
+	}
+	for _, name := range pasetoTimeClaims {
+		value, ok := payload[name]
+		if !ok {
+			continue
+		}
+		text, _ := value.(string)
+		parsed, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token payload: %s must be an RFC 3339 time", name)
+		}
+		payload[name] = parsed.Unix()
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	claims := &utils.AccessTokenClaims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, fmt.Errorf("invalid token payload: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,162 @@
+package impl
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+
+	"medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+const (
+	pasetoLocalHeader = "v4.local."
+
+	pasetoNonceSize = 32
+	pasetoTagSize   = 32
+)
+
+// PASETOLocalTokenFormat issues PASETO v4.local tokens: claims encrypted
+// with XChaCha20 and authenticated with BLAKE2b under a shared key. Only
+// services holding the key can read them, introspection works for the
+// others.
+type PASETOLocalTokenFormat struct {
+	key []byte
+}
+
+func NewPASETOLocalTokenFormat(key []byte) (intf.TokenFormat, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s key must be 32 bytes, got %d", pasetoLocalHeader[:len(pasetoLocalHeader)-1], len(key))
+	}
+	return &PASETOLocalTokenFormat{key: key}, nil
+}
+
+func (f *PASETOLocalTokenFormat) Issue(claims *utils.AccessTokenClaims) (string, error) {
+	message, err := encodePASETOClaims(claims)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, pasetoNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return pasetoLocalEncrypt(f.key, nonce, message, nil, nil)
+}
+
+func (f *PASETOLocalTokenFormat) Parse(token string, validateClaims bool) (*utils.AccessTokenClaims, error) {
+	message, footer, err := pasetoLocalDecrypt(f.key, token, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(footer) > 0 {
+		return nil, errors.New("token footer is not expected")
+	}
+
+	claims, err := decodePASETOClaims(message)
+	if err != nil {
+		return nil, err
+	}
+	return validateTokenClaims(claims, validateClaims)
+}
+
+// pasetoLocalEncrypt is v4.local Encrypt of the PASETO specification with
+// the nonce supplied by the caller. The format issues tokens without footer
+// and implicit assertion.
+func pasetoLocalEncrypt(key, nonce, message, footer, implicit []byte) (string, error) {
+	encryptionKey, counterNonce, authKey, err := splitPASETOLocalKey(key, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	tag, err := pasetoTag(authKey, nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return "", err
+	}
+
+	body := append(append(append([]byte{}, nonce...), ciphertext...), tag...)
+	return joinPASETO(pasetoLocalHeader, body, footer), nil
+}
+
+// pasetoLocalDecrypt is v4.local Decrypt of the PASETO specification. It
+// returns the message and the footer, which is authenticated but not
+// checked against an expected value.
+func pasetoLocalDecrypt(key []byte, token string, implicit []byte) ([]byte, []byte, error) {
+	body, footer, err := splitPASETO(token, pasetoLocalHeader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) < pasetoNonceSize+pasetoTagSize {
+		return nil, nil, errors.New("token is malformed")
+	}
+
+	nonce := body[:pasetoNonceSize]
+	ciphertext := body[pasetoNonceSize : len(body)-pasetoTagSize]
+	tag := body[len(body)-pasetoTagSize:]
+
+	encryptionKey, counterNonce, authKey, err := splitPASETOLocalKey(key, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	expectedTag, err := pasetoTag(authKey, nonce, ciphertext, footer, implicit)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare(tag, expectedTag) != 1 {
+		return nil, nil, errors.New("token authentication failed")
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, footer, nil
+}
+
+// splitPASETOLocalKey derives the per-token encryption key, XChaCha20 nonce
+// and authentication key from the shared key and the random nonce.
+func splitPASETOLocalKey(key, nonce []byte) ([]byte, []byte, []byte, error) {
+	derived, err := keyedBLAKE2b(key, 56, []byte("paseto-encryption-key"), nonce)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	authKey, err := keyedBLAKE2b(key, 32, []byte("paseto-auth-key-for-aead"), nonce)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return derived[:32], derived[32:], authKey, nil
+}
+
+func pasetoTag(authKey, nonce, ciphertext, footer, implicit []byte) ([]byte, error) {
+	return keyedBLAKE2b(authKey, pasetoTagSize, pae([]byte(pasetoLocalHeader), nonce, ciphertext, footer, implicit))
+}
+
+func keyedBLAKE2b(key []byte, size int, message ...[]byte) ([]byte, error) {
+	hash, err := blake2b.New(size, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range message {
+		hash.Write(part)
+	}
+	return hash.Sum(nil), nil
+}
+
+// Discard does nothing: a self-contained token is not stored, and one whose
+// session was never saved fails the session check wherever it is presented.
+func (f *PASETOLocalTokenFormat) Discard(string) error {
+	return nil
+}
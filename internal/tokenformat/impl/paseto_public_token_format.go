@@ -0,0 +1,110 @@
+package impl
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"medods_test_task/internal/signing"
+	"medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+const pasetoPublicHeader = "v4.public."
+
+// PASETOPublicTokenFormat issues PASETO v4.public tokens, signed with the
+// Ed25519 keys of the keyring. The footer names the key as {"kid":...}, so
+// key rotation works like it does for JWTs.
+type PASETOPublicTokenFormat struct {
+	keyring *signing.Keyring
+}
+
+type pasetoFooter struct {
+	Kid string `json:"kid"`
+}
+
+func NewPASETOPublicTokenFormat(keyring *signing.Keyring) (intf.TokenFormat, error) {
+	if alg := keyring.Active().Method.Alg(); alg != signing.AlgorithmEdDSA {
+		return nil, fmt.Errorf("%s tokens require %s keys, got %s", pasetoPublicHeader[:len(pasetoPublicHeader)-1], signing.AlgorithmEdDSA, alg)
+	}
+	return &PASETOPublicTokenFormat{keyring: keyring}, nil
+}
+
+func (f *PASETOPublicTokenFormat) Issue(claims *utils.AccessTokenClaims) (string, error) {
+	key := f.keyring.Active()
+	privateKey, ok := key.SignKey().(ed25519.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("signing key %s is not an Ed25519 key", key.ID)
+	}
+
+	message, err := encodePASETOClaims(claims)
+	if err != nil {
+		return "", err
+	}
+	footer, err := json.Marshal(pasetoFooter{Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	return pasetoPublicSign(privateKey, message, footer, nil), nil
+}
+
+func (f *PASETOPublicTokenFormat) Parse(token string, validateClaims bool) (*utils.AccessTokenClaims, error) {
+	body, footer, err := splitPASETO(token, pasetoPublicHeader)
+	if err != nil {
+		return nil, err
+	}
+	key := f.keyring.Active()
+	if len(footer) > 0 {
+		var decoded pasetoFooter
+		if err := json.Unmarshal(footer, &decoded); err != nil {
+			return nil, errors.New("token footer is malformed")
+		}
+		var ok bool
+		if key, ok = f.keyring.Resolve(decoded.Kid); !ok {
+			return nil, fmt.Errorf("unknown signing key: %v", decoded.Kid)
+		}
+	}
+	publicKey, ok := key.VerifyKey().(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", key.ID)
+	}
+
+	message, err := pasetoPublicVerify(publicKey, body, footer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := decodePASETOClaims(message)
+	if err != nil {
+		return nil, err
+	}
+	return validateTokenClaims(claims, validateClaims)
+}
+
+// pasetoPublicSign is v4.public Sign of the PASETO specification. The
+// format always passes the key footer and no implicit assertion.
+func pasetoPublicSign(privateKey ed25519.PrivateKey, message, footer, implicit []byte) string {
+	signature := ed25519.Sign(privateKey, pae([]byte(pasetoPublicHeader), message, footer, implicit))
+	return joinPASETO(pasetoPublicHeader, append(append([]byte{}, message...), signature...), footer)
+}
+
+// pasetoPublicVerify is v4.public Verify of the PASETO specification for a
+// token already split by splitPASETO, since the footer picks the key.
+func pasetoPublicVerify(publicKey ed25519.PublicKey, body, footer, implicit []byte) ([]byte, error) {
+	if len(body) < ed25519.SignatureSize {
+		return nil, errors.New("token is malformed")
+	}
+	message, signature := body[:len(body)-ed25519.SignatureSize], body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(publicKey, pae([]byte(pasetoPublicHeader), message, footer, implicit), signature) {
+		return nil, errors.New("token signature is invalid")
+	}
+	return message, nil
+}
+
+// Discard does nothing: a self-contained token is not stored, and one whose
+// session was never saved fails the session check wherever it is presented.
+func (f *PASETOPublicTokenFormat) Discard(string) error {
+	return nil
+}
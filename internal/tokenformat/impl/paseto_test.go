@@ -0,0 +1,250 @@
+package impl
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"medods_test_task/internal/signing"
+	"medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+// pasetoVector is a test case of testdata/paseto_v4.json, a copy of v4.json
+// from https://github.com/paseto-standard/test-vectors.
+type pasetoVector struct {
+	Name              string  `json:"name"`
+	ExpectFail        bool    `json:"expect-fail"`
+	Key               string  `json:"key"`
+	Nonce             string  `json:"nonce"`
+	PublicKey         string  `json:"public-key"`
+	SecretKey         string  `json:"secret-key"`
+	SecretKeyPEM      string  `json:"secret-key-pem"`
+	Token             string  `json:"token"`
+	Payload           *string `json:"payload"`
+	Footer            string  `json:"footer"`
+	ImplicitAssertion string  `json:"implicit-assertion"`
+}
+
+func loadPASETOVectors(t *testing.T) []pasetoVector {
+	t.Helper()
+	data, err := os.ReadFile("testdata/paseto_v4.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Tests []pasetoVector `json:"tests"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	return file.Tests
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPASETOLocalVectors(t *testing.T) {
+	for _, v := range loadPASETOVectors(t) {
+		if v.Key == "" {
+			continue
+		}
+		t.Run(v.Name, func(t *testing.T) {
+			key := decodeHex(t, v.Key)
+			implicit := []byte(v.ImplicitAssertion)
+
+			message, footer, err := pasetoLocalDecrypt(key, v.Token, implicit)
+			if v.ExpectFail {
+				if err == nil {
+					t.Fatal("pasetoLocalDecrypt accepted an invalid token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pasetoLocalDecrypt: %v", err)
+			}
+			if string(message) != *v.Payload || string(footer) != v.Footer {
+				t.Errorf("decrypted %q with footer %q, want %q with footer %q", message, footer, *v.Payload, v.Footer)
+			}
+
+			token, err := pasetoLocalEncrypt(key, decodeHex(t, v.Nonce), []byte(*v.Payload), []byte(v.Footer), implicit)
+			if err != nil {
+				t.Fatalf("pasetoLocalEncrypt: %v", err)
+			}
+			if token != v.Token {
+				t.Errorf("pasetoLocalEncrypt = %s, want %s", token, v.Token)
+			}
+		})
+	}
+}
+
+func TestPASETOPublicVectors(t *testing.T) {
+	for _, v := range loadPASETOVectors(t) {
+		if v.PublicKey == "" {
+			continue
+		}
+		t.Run(v.Name, func(t *testing.T) {
+			publicKey := ed25519.PublicKey(decodeHex(t, v.PublicKey))
+			implicit := []byte(v.ImplicitAssertion)
+
+			message, err := verifyPASETOPublicToken(publicKey, v.Token, implicit)
+			if v.ExpectFail {
+				if err == nil {
+					t.Fatal("pasetoPublicVerify accepted an invalid token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pasetoPublicVerify: %v", err)
+			}
+			if string(message) != *v.Payload {
+				t.Errorf("verified %q, want %q", message, *v.Payload)
+			}
+
+			privateKey := ed25519.PrivateKey(decodeHex(t, v.SecretKey))
+			if token := pasetoPublicSign(privateKey, []byte(*v.Payload), []byte(v.Footer), implicit); token != v.Token {
+				t.Errorf("pasetoPublicSign = %s, want %s", token, v.Token)
+			}
+		})
+	}
+}
+
+func verifyPASETOPublicToken(publicKey ed25519.PublicKey, token string, implicit []byte) ([]byte, error) {
+	body, footer, err := splitPASETO(token, pasetoPublicHeader)
+	if err != nil {
+		return nil, err
+	}
+	return pasetoPublicVerify(publicKey, body, footer, implicit)
+}
+
+// newPASETOPublicFormat uses the key of the 4-S vectors, with its kid.
+func newPASETOPublicFormat(t *testing.T) intf.TokenFormat {
+	t.Helper()
+	var vector pasetoVector
+	for _, v := range loadPASETOVectors(t) {
+		if v.Name == "4-S-2" {
+			vector = v
+		}
+	}
+	key, err := signing.ParseKey(signing.AlgorithmEdDSA, []byte(vector.SecretKeyPEM), "zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := NewPASETOPublicTokenFormat(signing.NewStaticKeyring(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return format
+}
+
+func newPASETOLocalFormat(t *testing.T) intf.TokenFormat {
+	t.Helper()
+	format, err := NewPASETOLocalTokenFormat(bytes.Repeat([]byte{0x70}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return format
+}
+
+// tamperPASETO rewrites the decoded body and footer of token.
+func tamperPASETO(t *testing.T, token, header string, tamper func(body, footer []byte) ([]byte, []byte)) string {
+	t.Helper()
+	body, footer, err := splitPASETO(token, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, footer = tamper(body, footer)
+	return joinPASETO(header, body, footer)
+}
+
+func TestPASETOTokenFormats(t *testing.T) {
+	formats := []struct {
+		name   string
+		header string
+		format intf.TokenFormat
+	}{
+		{"v4.local", pasetoLocalHeader, newPASETOLocalFormat(t)},
+		{"v4.public", pasetoPublicHeader, newPASETOPublicFormat(t)},
+	}
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			claims := utils.NewAccessTokenClaims(utils.AccessTokenParams{
+				UserID:         uuid.New(),
+				RefreshTokenID: uuid.New(),
+				Scopes:         []string{"profile", "records:read"},
+				Roles:          []string{"patient"},
+			})
+			token, err := f.format.Issue(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(token, f.header) {
+				t.Fatalf("token %s does not start with %s", token, f.header)
+			}
+
+			parsed, err := f.format.Parse(token, true)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if parsed.Subject != claims.Subject || parsed.RefreshTokenID != claims.RefreshTokenID ||
+				parsed.Scope != claims.Scope || !parsed.ExpiresAt.Equal(claims.ExpiresAt.Time) {
+				t.Errorf("Parse = %+v, want %+v", parsed, claims)
+			}
+
+			tampered := map[string]string{
+				"payload": tamperPASETO(t, token, f.header, func(body, footer []byte) ([]byte, []byte) {
+					body[len(body)/2] ^= 1
+					return body, footer
+				}),
+				"footer added": tamperPASETO(t, token, f.header, func(body, footer []byte) ([]byte, []byte) {
+					return body, []byte(`{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN","x":1}`)
+				}),
+				"truncated": tamperPASETO(t, token, f.header, func(body, footer []byte) ([]byte, []byte) {
+					return body[:len(body)-1], footer
+				}),
+			}
+			if f.header == pasetoPublicHeader {
+				tampered["footer removed"] = tamperPASETO(t, token, f.header, func(body, footer []byte) ([]byte, []byte) {
+					return body, nil
+				})
+			}
+			for name, token := range tampered {
+				if _, err := f.format.Parse(token, false); err == nil {
+					t.Errorf("Parse accepted a token with tampered %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestPASETOTokenFormatsRejectVectorsWithImplicitAssertion(t *testing.T) {
+	for _, v := range loadPASETOVectors(t) {
+		if v.ExpectFail || v.ImplicitAssertion == "" {
+			continue
+		}
+		t.Run(v.Name, func(t *testing.T) {
+			format := newPASETOPublicFormat(t)
+			if v.Key != "" {
+				var err error
+				if format, err = NewPASETOLocalTokenFormat(decodeHex(t, v.Key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := format.Parse(v.Token, false); err == nil {
+				t.Error("Parse accepted a token bound to an implicit assertion")
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package impl
+
+import (
+	"sync"
+	"time"
+
+	"medods_test_task/internal/utils"
+)
+
+// referenceCache keeps the claims of recently seen references until they
+// expire, so most requests skip the database. Claims never change once
+// issued and revocation is checked against the session, so a cached entry
+// cannot go stale. It is local to the instance.
+type referenceCache struct {
+	mu        sync.Mutex
+	claims    map[string]cachedClaims
+	nextSweep time.Time
+}
+
+type cachedClaims struct {
+	claims    *utils.AccessTokenClaims
+	expiresAt time.Time
+}
+
+func newReferenceCache() *referenceCache {
+	return &referenceCache{claims: make(map[string]cachedClaims)}
+}
+
+func (c *referenceCache) store(tokenHash string, claims *utils.AccessTokenClaims, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !now.Before(c.nextSweep) {
+		for hash, cached := range c.claims {
+			if !now.Before(cached.expiresAt) {
+				delete(c.claims, hash)
+			}
+		}
+		c.nextSweep = now.Add(time.Second)
+	}
+	if now.Before(expiresAt) {
+		c.claims[tokenHash] = cachedClaims{claims: claims, expiresAt: expiresAt}
+	}
+}
+
+func (c *referenceCache) load(tokenHash string) (*utils.AccessTokenClaims, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.claims[tokenHash]
+	if !ok || !time.Now().Before(cached.expiresAt) {
+		return nil, false
+	}
+	claims := *cached.claims
+	return &claims, true
+}
+
+func (c *referenceCache) delete(tokenHash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.claims, tokenHash)
+}
@@ -0,0 +1,125 @@
+package impl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/model"
+	repoIntf "medods_test_task/internal/repository/intf"
+	"medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+// referencePurgeInterval is how often Issue removes references past their
+// retention.
+const referencePurgeInterval = time.Minute
+
+// ReferenceTokenFormat issues opaque access tokens: a random reference is
+// handed to the client, while the claims stay in the database under its
+// hash. Expired references are kept for retention, so refresh and
+// revocation can still tell which session they belonged to.
+type ReferenceTokenFormat struct {
+	accessTokenRepository repoIntf.AccessTokenRepository
+	cache                 *referenceCache
+	retention             time.Duration
+
+	purgeMu   sync.Mutex
+	nextPurge time.Time
+}
+
+func NewReferenceTokenFormat(accessTokenRepository repoIntf.AccessTokenRepository, retention time.Duration) intf.TokenFormat {
+	return &ReferenceTokenFormat{
+		accessTokenRepository: accessTokenRepository,
+		cache:                 newReferenceCache(),
+		retention:             retention,
+	}
+}
+
+func (f *ReferenceTokenFormat) Issue(claims *utils.AccessTokenClaims) (string, error) {
+	reference, err := utils.GenerateAccessTokenReference()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	tokenHash := utils.HashAccessTokenReference(reference)
+	err = f.accessTokenRepository.Create(&model.AccessToken{
+		TokenHash:      tokenHash,
+		RefreshTokenID: claims.RefreshTokenID,
+		Claims:         string(data),
+		ExpiresAt:      claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store access token: %w", err)
+	}
+
+	f.cache.store(tokenHash, claims, claims.ExpiresAt.Time)
+	f.purgeExpired()
+	return reference, nil
+}
+
+func (f *ReferenceTokenFormat) Parse(reference string, validateClaims bool) (*utils.AccessTokenClaims, error) {
+	tokenHash := utils.HashAccessTokenReference(reference)
+	claims, ok := f.cache.load(tokenHash)
+	if !ok {
+		accessToken, err := f.accessTokenRepository.GetByHash(tokenHash)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("access token is unknown")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load access token: %w", err)
+		}
+
+		claims = &utils.AccessTokenClaims{}
+		if err := json.Unmarshal([]byte(accessToken.Claims), claims); err != nil {
+			return nil, fmt.Errorf("invalid stored claims: %w", err)
+		}
+		f.cache.store(tokenHash, claims, accessToken.ExpiresAt)
+	}
+	return validateTokenClaims(claims, validateClaims)
+}
+
+// Discard deletes the stored reference, so it does not outlive the failed
+// request that issued it.
+func (f *ReferenceTokenFormat) Discard(reference string) error {
+	tokenHash := utils.HashAccessTokenReference(reference)
+	f.cache.delete(tokenHash)
+	if err := f.accessTokenRepository.Delete(tokenHash); err != nil {
+		return fmt.Errorf("failed to delete access token: %w", err)
+	}
+	return nil
+}
+
+// purgeExpired deletes references past their retention at most once per
+// referencePurgeInterval, in the background.
+func (f *ReferenceTokenFormat) purgeExpired() {
+	f.purgeMu.Lock()
+	defer f.purgeMu.Unlock()
+
+	now := time.Now()
+	if now.Before(f.nextPurge) {
+		return
+	}
+	f.nextPurge = now.Add(referencePurgeInterval)
+
+	go func() {
+		deleted, err := f.accessTokenRepository.DeleteExpiredBefore(now.Add(-f.retention))
+		if err != nil {
+			log.Printf("failed to purge expired access tokens: %v", err)
+			return
+		}
+		if deleted > 0 {
+			log.Printf("Purged %d expired access tokens", deleted)
+		}
+	}()
+}
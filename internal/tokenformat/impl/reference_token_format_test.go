@@ -0,0 +1,131 @@
+package impl
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/tokenformat/intf"
+	"medods_test_task/internal/utils"
+)
+
+// memoryAccessTokens keeps reference access tokens in memory.
+type memoryAccessTokens struct {
+	mu     sync.Mutex
+	tokens map[string]model.AccessToken
+}
+
+func (r *memoryAccessTokens) Create(token *model.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (r *memoryAccessTokens) GetByHash(tokenHash string) (*model.AccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &token, nil
+}
+
+func (r *memoryAccessTokens) Delete(tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, tokenHash)
+	return nil
+}
+
+func (r *memoryAccessTokens) DeleteExpiredBefore(before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for hash, token := range r.tokens {
+		if token.ExpiresAt.Before(before) {
+			delete(r.tokens, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestReferenceTokenFormat(t *testing.T) {
+	repo := &memoryAccessTokens{tokens: make(map[string]model.AccessToken)}
+	issuer := NewReferenceTokenFormat(repo, time.Hour)
+	// Another instance has nothing cached and reads the database.
+	other := NewReferenceTokenFormat(repo, time.Hour)
+
+	userID, sessionID := uuid.New(), uuid.New()
+	reference, err := issuer.Issue(utils.NewAccessTokenClaims(utils.AccessTokenParams{
+		UserID:         userID,
+		RefreshTokenID: sessionID,
+		Scopes:         []string{"profile"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(reference, ".") {
+		t.Errorf("reference %q looks like a self-contained token", reference)
+	}
+	stored, err := repo.GetByHash(utils.HashAccessTokenReference(reference))
+	if err != nil {
+		t.Fatalf("the reference is not stored under its hash: %v", err)
+	}
+	if stored.RefreshTokenID != sessionID || strings.Contains(stored.Claims, reference) {
+		t.Errorf("stored row of session %s, want %s, without the reference itself", stored.RefreshTokenID, sessionID)
+	}
+
+	for name, format := range map[string]intf.TokenFormat{"issuing instance": issuer, "other instance": other} {
+		claims, err := format.Parse(reference, true)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if claims.Subject != userID.String() || claims.RefreshTokenID != sessionID || claims.Scope != "profile" {
+			t.Errorf("%s: claims of %s, session %s, scope %q; want %s, %s, profile", name, claims.Subject, claims.RefreshTokenID, claims.Scope, userID, sessionID)
+		}
+	}
+	if _, err := other.Parse("unknown", false); err == nil {
+		t.Error("an unknown reference parsed")
+	}
+
+	if err := issuer.Discard(reference); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.tokens) != 0 {
+		t.Error("a discarded reference is still stored")
+	}
+	if _, err := issuer.Parse(reference, false); err == nil {
+		t.Error("a discarded reference parsed from the cache")
+	}
+}
+
+func TestReferenceTokenFormatRejectsExpiredReference(t *testing.T) {
+	repo := &memoryAccessTokens{tokens: make(map[string]model.AccessToken)}
+	format := NewReferenceTokenFormat(repo, time.Hour)
+	claims := utils.NewAccessTokenClaims(utils.AccessTokenParams{UserID: uuid.New(), RefreshTokenID: uuid.New()})
+	claims.ExpiresAt.Time = time.Now().Add(-time.Minute)
+
+	reference, err := format.Issue(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := format.Parse(reference, true); err == nil {
+		t.Error("an expired reference passed validation")
+	}
+	// Refresh and revocation still find the session of an expired reference.
+	parsed, err := format.Parse(reference, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.RefreshTokenID != claims.RefreshTokenID {
+		t.Errorf("session = %s, want %s", parsed.RefreshTokenID, claims.RefreshTokenID)
+	}
+}
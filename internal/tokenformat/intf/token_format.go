@@ -0,0 +1,17 @@
+package intf
+
+import "medods_test_task/internal/utils"
+
+// TokenFormat turns access token claims into a token and back. Every
+// format carries the same claims, so the rest of the service does not care
+// which one is configured.
+type TokenFormat interface {
+	// Issue protects claims with the current key.
+	Issue(claims *utils.AccessTokenClaims) (string, error)
+	// Parse verifies token and returns its claims. Issuer, audience and
+	// lifetime are only checked when validateClaims is set.
+	Parse(token string, validateClaims bool) (*utils.AccessTokenClaims, error)
+	// Discard withdraws a token issued for a session that was never saved.
+	// Only formats that store what they issue have anything to do.
+	Discard(token string) error
+}
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+// CertificateThumbprint returns the x5t#S256 value of RFC 8705 for the TLS
+// client certificate of r, or an empty string when there is none.
+func CertificateThumbprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
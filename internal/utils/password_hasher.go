@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+// Argon2Params are the Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params are the second recommended option of RFC 9106.
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 4}
+
+// PasswordHasher hashes passwords with Argon2id into the PHC string format
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>,
+// so every hash carries the parameters it was made with.
+type PasswordHasher struct {
+	params Argon2Params
+}
+
+func NewPasswordHasher(params Argon2Params) *PasswordHasher {
+	return &PasswordHasher{params: params}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return encodeArgon2(h.params, salt, argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2KeyLength)), nil
+}
+
+// Verify checks password against an encoded hash. needsRehash reports that
+// the hash was made with other parameters than the current ones and should
+// be replaced now that the password is known.
+func (h *PasswordHasher) Verify(encoded, password string) (ok, needsRehash bool, err error) {
+	params, salt, key, err := decodeArgon2(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+	return true, params != h.params || len(key) != argon2KeyLength, nil
+}
+
+func encodeArgon2(params Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	return params, salt, key, nil
+}
+
+// NormalizeLogin returns the form logins are stored and looked up in, so
+// usernames and emails match regardless of case.
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"medods_test_task/internal/config"
+)
+
+const hmacHashPrefix = "hmac-sha256$"
+
+// RefreshTokenHasher hashes refresh token secrets with HMAC-SHA256 keyed by
+// a server pepper. Refresh token secrets are 32 random bytes, so a slow
+// password hash adds CPU cost without adding security; the pepper keeps a
+// leaked database from being enough to check guesses.
+type RefreshTokenHasher struct {
+	pepper []byte
+}
+
+func NewRefreshTokenHasher(pepper []byte) *RefreshTokenHasher {
+	return &RefreshTokenHasher{pepper: pepper}
+}
+
+func (h *RefreshTokenHasher) Hash(secret string) string {
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(secret))
+	return hmacHashPrefix + base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks secret against a stored hash. Hashes written before the
+// switch to HMAC are bcrypt and are still accepted. A verified token is
+// always rotated or deactivated right away and its successor is hashed with
+// HMAC, so bcrypt rows disappear as they are used.
+func (h *RefreshTokenHasher) Verify(hash, secret string) bool {
+	if !strings.HasPrefix(hash, hmacHashPrefix) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+	}
+	return hmac.Equal([]byte(hash), []byte(h.Hash(secret)))
+}
+
+func HashRefreshToken(secret string) string {
+	return NewRefreshTokenHasher(config.Load().RefreshTokenPepper).Hash(secret)
+}
+
+func VerifyRefreshToken(hash, secret string) bool {
+	return NewRefreshTokenHasher(config.Load().RefreshTokenPepper).Verify(hash, secret)
+}
+
+// HashAccessTokenReference hashes a reference access token for lookup. Like
+// refresh token secrets, references are random, so the same keyed hash is
+// used.
+func HashAccessTokenReference(reference string) string {
+	return NewRefreshTokenHasher(config.Load().RefreshTokenPepper).Hash(reference)
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testPepper = []byte("test-pepper")
+
+func TestRefreshTokenHasherVerifiesLegacyBcrypt(t *testing.T) {
+	hasher := NewRefreshTokenHasher(testPepper)
+	secret, err := GenerateRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasher.Verify(string(legacy), secret) {
+		t.Error("legacy bcrypt hash was rejected")
+	}
+	if hasher.Verify(string(legacy), secret+"x") {
+		t.Error("legacy bcrypt hash accepted a wrong secret")
+	}
+}
+
+func TestRefreshTokenHasherHMAC(t *testing.T) {
+	hasher := NewRefreshTokenHasher(testPepper)
+	hash := hasher.Hash("secret")
+
+	if !strings.HasPrefix(hash, hmacHashPrefix) {
+		t.Fatalf("hash %q is not HMAC", hash)
+	}
+	if !hasher.Verify(hash, "secret") {
+		t.Error("HMAC hash was rejected")
+	}
+	if hasher.Verify(hash, "other") {
+		t.Error("HMAC hash accepted a wrong secret")
+	}
+	if NewRefreshTokenHasher([]byte("other-pepper")).Verify(hash, "secret") {
+		t.Error("HMAC hash verified with another pepper")
+	}
+}
+
+func benchmarkHashes(b *testing.B) (hasher *RefreshTokenHasher, secret string, hashes map[string]string) {
+	hasher = NewRefreshTokenHasher(testPepper)
+	secret, err := GenerateRefreshToken()
+	if err != nil {
+		b.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return hasher, secret, map[string]string{
+		"bcrypt":      string(legacy),
+		"hmac-sha256": hasher.Hash(secret),
+	}
+}
+
+// BenchmarkHash compares issuing a refresh token hash with the legacy bcrypt
+// scheme and with HMAC-SHA256:
+//
+//	go test ./internal/utils -run '^$' -bench .
+func BenchmarkHash(b *testing.B) {
+	hasher, secret, _ := benchmarkHashes(b)
+
+	b.Run("bcrypt", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		}
+	})
+	b.Run("hmac-sha256", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			hasher.Hash(secret)
+		}
+	})
+}
+
+// BenchmarkVerify compares checking a presented refresh token against each
+// kind of stored hash.
+func BenchmarkVerify(b *testing.B) {
+	hasher, secret, hashes := benchmarkHashes(b)
+
+	for _, name := range []string{"bcrypt", "hmac-sha256"} {
+		hash := hashes[name]
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hasher.Verify(hash, secret)
+			}
+		})
+	}
+	b.Run("hmac-sha256-parallel", func(b *testing.B) {
+		hash := hashes["hmac-sha256"]
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				hasher.Verify(hash, secret)
+			}
+		})
+	})
+}
@@ -0,0 +1,51 @@
+package utils
+
+import "strings"
+
+// ParseScope splits a space-delimited scope string as defined in RFC 6749
+// section 3.3, dropping duplicates.
+func ParseScope(scope string) []string {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// IntersectScopes returns the scopes of requested that are in allowed, in
+// the requested order.
+func IntersectScopes(requested, allowed []string) []string {
+	set := make(map[string]bool, len(allowed))
+	for _, s := range allowed {
+		set[s] = true
+	}
+	var scopes []string
+	for _, s := range requested {
+		if set[s] {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// ContainsScopes reports whether granted includes every scope in required.
+func ContainsScopes(granted, required []string) bool {
+	set := make(map[string]bool, len(granted))
+	for _, s := range granted {
+		set[s] = true
+	}
+	for _, s := range required {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
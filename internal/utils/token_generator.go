@@ -3,23 +3,128 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
 	"medods_test_task/internal/config"
+	"medods_test_task/internal/model"
+	"medods_test_task/internal/signing"
 )
 
-func GenerateAccessToken(refreshTokenID uuid.UUID) (string, error) {
-	claims := jwt.MapClaims{
-		"refresh_token_id": refreshTokenID.String(),
-		"exp":              time.Now().Add(config.Load().AccessTokenTTL).Unix(),
-		"iat":              time.Now().Unix(),
+type AccessTokenClaims struct {
+	RefreshTokenID uuid.UUID     `json:"refresh_token_id"`
+	Scope          string        `json:"scope,omitempty"`
+	Roles          []string      `json:"roles,omitempty"`
+	Act            *Actor        `json:"act,omitempty"`
+	Cnf            *Confirmation `json:"cnf,omitempty"`
+	// Extra holds enriched claims. They are serialised next to the others
+	// but never override them, and are not read back when parsing.
+	Extra map[string]interface{} `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// Confirmation is the cnf claim binding a token to the key of a DPoP proof
+// (RFC 9449) or to a TLS client certificate (RFC 8705).
+type Confirmation struct {
+	JKT     string `json:"jkt,omitempty"`
+	X5TS256 string `json:"x5t#S256,omitempty"`
+}
+
+// Actor is the act claim of RFC 8693 section 4.1: the party acting on
+// behalf of sub. A nested Act records the previous actor in the chain.
+type Actor struct {
+	Sub      string `json:"sub,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Act      *Actor `json:"act,omitempty"`
+}
+
+// AccessTokenParams is what an access token is issued with. Extra holds
+// enriched claims, which never override the ones set by the service.
+type AccessTokenParams struct {
+	UserID         uuid.UUID
+	RefreshTokenID uuid.UUID
+	Scopes         []string
+	Roles          []string
+	Act            *Actor
+	Cnf            *Confirmation
+	Extra          map[string]interface{}
+}
+
+func (c *AccessTokenClaims) Scopes() []string {
+	return ParseScope(c.Scope)
+}
+
+// reservedClaims may not be set by a claims enricher: they are either issued
+// by the service itself or carry security meaning for resource servers.
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"refresh_token_id": true, "scope": true, "roles": true, "client_id": true, "azp": true,
+	"auth_time": true, "nonce": true, "sid": true, "cnf": true, "act": true, "may_act": true,
+}
+
+// FilterReservedClaims returns extra without reserved claims, together with
+// the names of the claims it dropped.
+func FilterReservedClaims(extra map[string]interface{}) (map[string]interface{}, []string) {
+	var dropped []string
+	filtered := make(map[string]interface{}, len(extra))
+	for name, value := range extra {
+		if reservedClaims[name] {
+			dropped = append(dropped, name)
+			continue
+		}
+		filtered[name] = value
+	}
+	return filtered, dropped
+}
+
+// MarshalJSON serialises the claims together with Extra. Claims set by the
+// service always win over extra ones.
+func (c AccessTokenClaims) MarshalJSON() ([]byte, error) {
+	type plainClaims AccessTokenClaims
+	data, err := json.Marshal(plainClaims(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	return token.SignedString(config.Load().JWTSecret)
+	var merged map[string]interface{}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	extra, _ := FilterReservedClaims(c.Extra)
+	for name, value := range extra {
+		if _, exists := merged[name]; !exists {
+			merged[name] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// NewAccessTokenClaims builds the claims of an access token issued now.
+// The configured token format turns them into the token itself.
+func NewAccessTokenClaims(params AccessTokenParams) *AccessTokenClaims {
+	cfg := config.Load()
+	now := time.Now()
+	return &AccessTokenClaims{
+		RefreshTokenID: params.RefreshTokenID,
+		Scope:          FormatScope(params.Scopes),
+		Roles:          params.Roles,
+		Act:            params.Act,
+		Cnf:            params.Cnf,
+		Extra:          params.Extra,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.Issuer,
+			Subject:   params.UserID.String(),
+			Audience:  jwt.ClaimStrings{cfg.JWTAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.AccessTokenTTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
+	}
 }
 
 func GenerateRefreshToken() (string, error) {
@@ -31,3 +136,61 @@ func GenerateRefreshToken() (string, error) {
 	token := base64.StdEncoding.EncodeToString(raw)
 	return token, nil
 }
+
+// GenerateAccessTokenReference returns the random string handed out as a
+// reference access token.
+func GenerateAccessTokenReference() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// FormatRefreshToken builds a self-contained refresh token of the form
+// <id>.<secret>, so it can be exchanged without an access token.
+func FormatRefreshToken(refreshTokenID uuid.UUID, secret string) string {
+	return refreshTokenID.String() + "." + secret
+}
+
+// SplitRefreshToken extracts the ID and secret from a self-contained refresh
+// token. Legacy tokens are just the secret and yield uuid.Nil.
+func SplitRefreshToken(rawRefreshToken string) (uuid.UUID, string) {
+	idPart, secret, found := strings.Cut(rawRefreshToken, ".")
+	if !found {
+		return uuid.Nil, rawRefreshToken
+	}
+	refreshTokenID, err := uuid.Parse(idPart)
+	if err != nil {
+		return uuid.Nil, rawRefreshToken
+	}
+	return refreshTokenID, secret
+}
+
+// GenerateIDToken issues an OpenID Connect id_token for the session. It
+// expires together with the access token issued next to it.
+func GenerateIDToken(key *signing.Key, session *model.RefreshToken) (string, error) {
+	cfg := config.Load()
+	audience := session.ClientID
+	if audience == "" {
+		audience = cfg.OIDCClientID
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       cfg.Issuer,
+		"sub":       session.UserID.String(),
+		"aud":       audience,
+		"exp":       now.Add(cfg.AccessTokenTTL).Unix(),
+		"iat":       now.Unix(),
+		"auth_time": session.StartedAt().Unix(),
+		"sid":       session.Family().String(),
+	}
+	if session.Nonce != "" {
+		claims["nonce"] = session.Nonce
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey())
+}
@@ -12,13 +12,29 @@ import (
 	"medods_test_task/internal/config"
 )
 
+const (
+	EventIPMismatch         = "ip_mismatch"
+	EventTokenReuseDetected = "token_reuse_detected"
+	EventSessionEvicted     = "session_evicted"
+	EventImpersonation      = "impersonation_started"
+)
+
 func SendWarningToWebhook(userID uuid.UUID, ip, newIp, userAgent string) (err error) {
-	payload := map[string]interface{}{
-		"user_id":    userID.String(),
+	return SendEventToWebhook(EventIPMismatch, userID, map[string]interface{}{
 		"ip":         ip,
 		"new_ip":     newIp,
 		"user_agent": userAgent,
-		"timestamp":  time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func SendEventToWebhook(event string, userID uuid.UUID, details map[string]interface{}) (err error) {
+	payload := map[string]interface{}{
+		"event":     event,
+		"user_id":   userID.String(),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+	for key, value := range details {
+		payload[key] = value
 	}
 
 	body, err := json.Marshal(payload)
@@ -45,6 +61,6 @@ func SendWarningToWebhook(userID uuid.UUID, ip, newIp, userAgent string) (err er
 		}
 	}()
 
-	log.Printf("Webhook sent. Status: %s", resp.Status)
+	log.Printf("Webhook sent. Event: %s. Status: %s", event, resp.Status)
 	return nil
 }
@@ -0,0 +1,23 @@
+#!/bin/bash
+# Generates self-signed certificates for local mTLS testing:
+# a CA, a server certificate for localhost and a client certificate.
+set -euo pipefail
+
+dir="${1:-certs}"
+mkdir -p "$dir"
+cd "$dir"
+
+openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 365 \
+  -subj "/CN=medods local CA" -keyout ca.key -out ca.crt
+
+openssl req -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+  -subj "/CN=localhost" -keyout server.key -out server.csr
+openssl x509 -req -in server.csr -CA ca.crt -CAkey ca.key -CAcreateserial -days 365 \
+  -extfile <(printf "subjectAltName=DNS:localhost,IP:127.0.0.1\nextendedKeyUsage=serverAuth") -out server.crt
+
+openssl req -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes \
+  -subj "/CN=${CLIENT_CN:-medods-client}" -keyout client.key -out client.csr
+openssl x509 -req -in client.csr -CA ca.crt -CAkey ca.key -CAcreateserial -days 365 \
+  -extfile <(printf "extendedKeyUsage=clientAuth") -out client.crt
+
+rm -f server.csr client.csr ca.srl